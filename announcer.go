@@ -33,7 +33,7 @@ type Announcer struct {
 	ch chan struct{}
 }
 
-func (a *Announcer) StartAnnouncer(name string, port int, audioAndVideo bool) {
+func (a *Announcer) StartAnnouncer(name string, port int, audioAndVideo bool, variants []Variant, tracks []int) {
 	a.ch = make(chan struct{})
 
 	a.Add(1)
@@ -53,6 +53,9 @@ func (a *Announcer) StartAnnouncer(name string, port int, audioAndVideo bool) {
 			Port:          port,
 			AudioAndVideo: audioAndVideo,
 			Version:       version,
+			Protocol:      protocolVersion,
+			Variants:      variants,
+			Tracks:        tracks,
 		}
 
 		b, _ := json.Marshal(j)
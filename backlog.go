@@ -0,0 +1,82 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+//
+import "C"
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EncoderBacklog decides whether a new frame is still worth encoding. When
+// more video waits to be encoded and sent than the configured bound, new
+// frames are dropped right away instead of adding to the latency.
+type EncoderBacklog struct {
+	sync.Mutex
+	dropped int
+	streak  int
+}
+
+// EncoderBacklogAccept reports whether a frame should be encoded while
+// waiting worth of video is queued up in front of it. A limit of 0 means
+// no limit.
+func (e *EncoderBacklog) EncoderBacklogAccept(waiting, limit time.Duration) bool {
+	e.Lock()
+	defer e.Unlock()
+
+	if limit > 0 && waiting > limit {
+		if e.streak == 0 {
+			blog(C.LOG_WARNING, "encoder backlog exceeded "+limit.String()+", dropping frames")
+		}
+		e.streak++
+		e.dropped++
+
+		return false
+	}
+
+	if e.streak > 0 {
+		blog(C.LOG_INFO, "encoder caught up, dropped "+strconv.Itoa(e.streak)+" frames")
+		e.streak = 0
+	}
+
+	return true
+}
+
+// EncoderBacklogReset clears the dropped frame count.
+func (e *EncoderBacklog) EncoderBacklogReset() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.dropped = 0
+	e.streak = 0
+}
+
+// EncoderBacklogDropped returns the number of frames dropped so far.
+func (e *EncoderBacklog) EncoderBacklogDropped() int {
+	e.Lock()
+	defer e.Unlock()
+
+	return e.dropped
+}
@@ -0,0 +1,418 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+// #include <util/platform.h>
+//
+import "C"
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The calibration pattern flashes white and beeps at the start of every
+// second of the sender's timeline. Every frame carries a strip of three
+// rows of 32 blocks at the bottom: a magic word, a running frame counter
+// and how far the frame lies past the start of the second, in µs.
+const (
+	calibrationPeriod    = time.Second
+	calibrationFlash     = 100 * time.Millisecond
+	calibrationTone      = 1000
+	calibrationLevel     = 0.5
+	calibrationThreshold = 0.1
+	calibrationQuiet     = 200 * time.Millisecond
+	calibrationMagic     = 0x54504c43
+	calibrationBits      = 32
+	calibrationRows      = 16
+	calibrationAverage   = 5
+)
+
+// CalibrationSignal replaces outgoing video with the calibration pattern.
+type CalibrationSignal struct {
+	sync.Mutex
+	counter uint32
+}
+
+// CalibrationSignalFrame draws the calibration pattern into the image of
+// packet p.
+func (c *CalibrationSignal) CalibrationSignalFrame(p *Packet) {
+	c.Lock()
+	c.counter++
+	counter := c.counter
+	c.Unlock()
+
+	lead := p.Header.Timestamp % uint64(calibrationPeriod)
+
+	width := p.Image.Bounds().Dx()
+	height := p.Image.Bounds().Dy()
+	block := max(height/calibrationRows, 1)
+	strip := height - 3*block
+
+	background := byte(0)
+	if lead < uint64(calibrationFlash) {
+		background = 255
+	}
+
+	calibrationFill(p.Image, 0, 0, width, strip, background)
+	calibrationNeutral(p.Image, strip, height)
+
+	for row, word := range []uint32{calibrationMagic, counter, uint32(lead / uint64(time.Microsecond))} {
+		for bit := 0; bit < calibrationBits; bit++ {
+			v := byte(0)
+			if word&(1<<(calibrationBits-1-bit)) != 0 {
+				v = 255
+			}
+
+			calibrationFill(p.Image, bit*width/calibrationBits, strip+row*block, (bit+1)*width/calibrationBits, strip+(row+1)*block, v)
+		}
+	}
+}
+
+// calibrationFill paints a gray rectangle. YCbCr images get their luma
+// scaled to limited range, which reads fine either way.
+func calibrationFill(img image.Image, x0, y0, x1, y1 int, v byte) {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		y := byte(16 + int(v)*219/255)
+
+		for row := y0; row < min(y1, img.Rect.Dy()); row++ {
+			line := img.Y[row*img.YStride:]
+			for col := x0; col < min(x1, img.Rect.Dx()); col++ {
+				line[col] = y
+			}
+		}
+	case *image.RGBA:
+		bpp := img.Stride / img.Rect.Dx()
+
+		for row := y0; row < min(y1, img.Rect.Dy()); row++ {
+			line := img.Pix[row*img.Stride:]
+			for col := x0; col < min(x1, img.Rect.Dx()); col++ {
+				line[col*bpp+0] = v
+				line[col*bpp+1] = v
+				line[col*bpp+2] = v
+			}
+		}
+	}
+}
+
+// calibrationNeutral clears the chroma of the rows y0 to y1 of YCbCr
+// images, so the blocks of the strip come out gray.
+func calibrationNeutral(img image.Image, y0, y1 int) {
+	ycbcr, ok := img.(*image.YCbCr)
+	if !ok || y1 <= y0 {
+		return
+	}
+
+	start := ycbcr.COffset(0, y0) / ycbcr.CStride * ycbcr.CStride
+	end := min((ycbcr.COffset(0, y1-1)/ycbcr.CStride+1)*ycbcr.CStride, len(ycbcr.Cb), len(ycbcr.Cr))
+
+	for i := start; i < end; i++ {
+		ycbcr.Cb[i] = 128
+		ycbcr.Cr[i] = 128
+	}
+}
+
+// calibrationLuma returns the brightness of a pixel, regardless of range.
+func calibrationLuma(img image.Image, x, y int) byte {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return img.Y[y*img.YStride+x]
+	case *image.RGBA:
+		return img.Pix[y*img.Stride+x*(img.Stride/img.Rect.Dx())+1]
+	}
+
+	return 0
+}
+
+// calibrationRead decodes the calibration pattern from img. It reports
+// whether the frame is a flash, its counter and its lead on the start of
+// the second.
+func calibrationRead(img image.Image) (bool, uint32, time.Duration, bool) {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	block := max(height/calibrationRows, 1)
+	strip := height - 3*block
+
+	if width < calibrationBits || strip <= 0 {
+		return false, 0, 0, false
+	}
+
+	var words [3]uint32
+
+	for row := range words {
+		y := strip + row*block + block/2
+
+		for bit := 0; bit < calibrationBits; bit++ {
+			x := (2*bit + 1) * width / (2 * calibrationBits)
+
+			words[row] <<= 1
+			if calibrationLuma(img, x, y) >= 128 {
+				words[row] |= 1
+			}
+		}
+	}
+
+	if words[0] != calibrationMagic {
+		return false, 0, 0, false
+	}
+
+	sum := 0
+	for i := 1; i < 4; i++ {
+		for j := 1; j < 4; j++ {
+			sum += int(calibrationLuma(img, i*width/4, j*strip/4))
+		}
+	}
+
+	return sum/9 >= 128, words[1], time.Duration(words[2]) * time.Microsecond, true
+}
+
+// ToCalibrationTone replaces the audio of the WAVE packet p with the beep
+// of the calibration pattern, as float samples.
+func (p *Packet) ToCalibrationTone() {
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(p.WaveHeader.Speakers)))
+	if channels == 0 || p.WaveHeader.Frames == 0 || p.WaveHeader.SampleRate <= 0 {
+		return
+	}
+
+	wave := make([]byte, int(p.WaveHeader.Frames)*channels*4)
+
+	for i := 0; i < int(p.WaveHeader.Frames); i++ {
+		t := time.Duration(p.Header.Timestamp%uint64(calibrationPeriod)) + time.Duration(i)*time.Second/time.Duration(p.WaveHeader.SampleRate)
+		t %= calibrationPeriod
+
+		v := float32(0)
+		if t < calibrationFlash {
+			v = float32(calibrationLevel * math.Cos(2*math.Pi*calibrationTone*t.Seconds()))
+		}
+
+		for j := 0; j < channels; j++ {
+			binary.LittleEndian.PutUint32(wave[(i*channels+j)*4:], math.Float32bits(v))
+		}
+	}
+
+	p.WaveHeader.Format = C.AUDIO_FORMAT_FLOAT
+	p.Header.Size = int32(len(wave))
+
+	h := bytes.Buffer{}
+
+	binary.Write(&h, binary.LittleEndian, &p.Header)
+	binary.Write(&h, binary.LittleEndian, &p.WaveHeader)
+
+	p.Buffer = append(h.Bytes(), wave...)
+}
+
+type calibrationEvent struct {
+	out     uint64
+	latency time.Duration
+	valid   bool
+}
+
+// CalibrationDetector finds the calibration pattern in presented packets.
+// Flashes and beeps are paired up by the timestamps they are output to OBS
+// with, which is what OBS plays them in sync by.
+type CalibrationDetector struct {
+	sync.Mutex
+	flashes  []calibrationEvent
+	beeps    []calibrationEvent
+	offsets  []time.Duration
+	dark     bool
+	loud     uint64
+	counter  uint32
+	lost     int
+	frames   int
+	offset   time.Duration
+	video    calibrationEvent
+	audio    calibrationEvent
+	measured bool
+}
+
+// CalibrationDetectorReset forgets all measurements, e.g. after a reconnect.
+func (c *CalibrationDetector) CalibrationDetectorReset() {
+	c.Lock()
+	defer c.Unlock()
+
+	*c = CalibrationDetector{}
+}
+
+// CalibrationDetectorAdd looks for the calibration pattern in packet p,
+// which is output to OBS at timestamp out. Every few measurements it
+// returns their median A/V offset. Positive means the audio is late.
+func (c *CalibrationDetector) CalibrationDetectorAdd(p *Packet, out uint64, clock *ClockSync) (time.Duration, bool) {
+	now := uint64(C.os_gettime_ns())
+
+	c.Lock()
+	defer c.Unlock()
+
+	if p.IsAudio {
+		c.addAudio(p, out, now, clock)
+	} else {
+		c.addVideo(p, out, now, clock)
+	}
+
+	for len(c.flashes) > 0 && len(c.beeps) > 0 {
+		flash := c.flashes[0]
+		beep := c.beeps[0]
+
+		offset := time.Duration(int64(beep.out - flash.out))
+
+		// unpaired events, e.g. a flash whose beep was lost
+		if offset > calibrationPeriod/2 {
+			c.flashes = c.flashes[1:]
+			continue
+		}
+		if offset < -calibrationPeriod/2 {
+			c.beeps = c.beeps[1:]
+			continue
+		}
+
+		c.flashes = c.flashes[1:]
+		c.beeps = c.beeps[1:]
+
+		c.offset = offset
+		c.video = flash
+		c.audio = beep
+		c.measured = true
+		c.offsets = append(c.offsets, offset)
+
+		blog(C.LOG_DEBUG, "calibration: "+c.calibrationString())
+	}
+
+	if len(c.offsets) < calibrationAverage {
+		return 0, false
+	}
+
+	slices.Sort(c.offsets)
+	median := c.offsets[len(c.offsets)/2]
+
+	c.offsets = nil
+	c.flashes = nil
+	c.beeps = nil
+
+	return median, true
+}
+
+func (c *CalibrationDetector) addVideo(p *Packet, out uint64, now uint64, clock *ClockSync) {
+	if p.Image == nil {
+		return
+	}
+
+	flash, counter, lead, ok := calibrationRead(p.Image)
+	if !ok {
+		return
+	}
+
+	// sender restarts reset the counter
+	if d := counter - c.counter; c.frames > 0 && d > 1 && d < 1<<16 {
+		c.lost += int(d - 1)
+	}
+	c.counter = counter
+	c.frames++
+
+	if !flash {
+		c.dark = true
+		return
+	}
+
+	if !c.dark {
+		return
+	}
+	c.dark = false
+
+	e := calibrationEvent{
+		out: out - uint64(lead),
+	}
+
+	if capture, ok := clock.ClockSyncToLocal(p.ImageHeader.Capture); ok && p.ImageHeader.Capture != 0 {
+		e.latency = time.Duration(int64(now - capture))
+		e.valid = true
+	}
+
+	c.flashes = append(c.flashes, e)
+}
+
+func (c *CalibrationDetector) addAudio(p *Packet, out uint64, now uint64, clock *ClockSync) {
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(p.WaveHeader.Speakers)))
+	if channels == 0 || p.WaveHeader.SampleRate <= 0 {
+		return
+	}
+
+	// a beep already under way on connect is no onset
+	if c.loud == 0 {
+		c.loud = out
+	}
+
+	samples := pcmToFloat(p.Buffer, p.WaveHeader.Format)
+
+	for i, v := range samples {
+		if v < calibrationThreshold && v > -calibrationThreshold {
+			continue
+		}
+
+		t := out + uint64(time.Duration(i/channels)*time.Second/time.Duration(p.WaveHeader.SampleRate))
+
+		if time.Duration(t-c.loud) > calibrationQuiet {
+			e := calibrationEvent{
+				out: t,
+			}
+
+			if capture, ok := clock.ClockSyncToLocal(p.WaveHeader.Capture); ok && p.WaveHeader.Capture != 0 {
+				e.latency = time.Duration(int64(now - capture))
+				e.valid = true
+			}
+
+			c.beeps = append(c.beeps, e)
+		}
+
+		c.loud = t
+	}
+}
+
+// CalibrationDetectorInfo returns the latest measurement.
+func (c *CalibrationDetector) CalibrationDetectorInfo() string {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.calibrationString()
+}
+
+func (c *CalibrationDetector) calibrationString() string {
+	if !c.measured {
+		return "Calibration: no signal"
+	}
+
+	s := fmt.Sprintf("Calibration (frame %d)\nA/V Offset: %.1f ms", c.counter, ms(c.offset))
+	if c.video.valid {
+		s += fmt.Sprintf("\nVideo Latency: %.1f ms", ms(c.video.latency))
+	}
+	if c.audio.valid {
+		s += fmt.Sprintf("\nAudio Latency: %.1f ms", ms(c.audio.latency))
+	}
+
+	return s + fmt.Sprintf("\nLost Frames: %d", c.lost)
+}
@@ -0,0 +1,102 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	chunkSize     = 64 << 10
+	chunkMaxTotal = 256 << 20
+)
+
+// chunkPacket returns the piece of the serialized packet b at offset as a
+// CHNK packet, and the offset of the next piece.
+func chunkPacket(b []byte, offset int) ([]byte, int) {
+	end := min(offset+chunkSize, len(b))
+
+	chunk := ChunkHeader{
+		Offset: uint32(offset),
+		Total:  uint32(len(b)),
+	}
+
+	header := Header{
+		Type:      [4]byte{'C', 'H', 'N', 'K'},
+		Timestamp: binary.LittleEndian.Uint64(b[4:]),
+		Size:      int32(binary.Size(chunk) + end - offset),
+	}
+
+	buf := bytes.Buffer{}
+
+	binary.Write(&buf, binary.LittleEndian, &header)
+	binary.Write(&buf, binary.LittleEndian, &chunk)
+	buf.Write(b[offset:end])
+
+	return buf.Bytes(), end
+}
+
+// ChunkAssembler puts the pieces of chunked packets back together. Only
+// one packet is sent in chunks at a time per connection.
+type ChunkAssembler struct {
+	buf   []byte
+	total uint32
+}
+
+// ChunkAssemblerAdd adds the payload b of a CHNK packet. Once a packet is
+// complete it returns it serialized, just as if it was sent in one piece.
+func (a *ChunkAssembler) ChunkAssemblerAdd(b []byte) ([]byte, error) {
+	var chunk ChunkHeader
+
+	err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &chunk)
+	if err != nil {
+		return nil, err
+	}
+
+	data := b[binary.Size(chunk):]
+
+	if chunk.Offset == 0 {
+		if chunk.Total > chunkMaxTotal {
+			return nil, errors.New("chunked packet too large")
+		}
+
+		a.buf = make([]byte, 0, chunk.Total)
+		a.total = chunk.Total
+	}
+
+	if a.buf == nil || chunk.Total != a.total || chunk.Offset != uint32(len(a.buf)) || len(a.buf)+len(data) > int(a.total) {
+		a.buf = nil
+		return nil, errors.New("chunk out of sequence")
+	}
+
+	a.buf = append(a.buf, data...)
+
+	if len(a.buf) < int(a.total) {
+		return nil, nil
+	}
+
+	b = a.buf
+	a.buf = nil
+
+	return b, nil
+}
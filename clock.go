@@ -0,0 +1,148 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <util/platform.h>
+//
+import "C"
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+const clockSyncSamples = 16
+
+type clockSample struct {
+	offset int64
+	delay  time.Duration
+}
+
+// ClockSync estimates the offset between the sender's and the local
+// os_gettime_ns clock the same way NTP does. Of the recent exchanges the
+// one with the shortest round trip is trusted most, as it suffered the
+// least from queueing on either side.
+type ClockSync struct {
+	sync.Mutex
+	samples []clockSample
+	offset  int64
+	delay   time.Duration
+	valid   bool
+}
+
+func syncPacket(j SyncPayload) []byte {
+	header := Header{
+		Type: [4]byte{'S', 'Y', 'N', 'C'},
+		Size: int32(binary.Size(j)),
+	}
+
+	b := bytes.Buffer{}
+
+	binary.Write(&b, binary.LittleEndian, &header)
+	binary.Write(&b, binary.LittleEndian, &j)
+
+	return b.Bytes()
+}
+
+// stampSync sets the transmit time of a SYNC packet right before it is
+// written, so time spent in the send queue doesn't count as network delay.
+func stampSync(b []byte) {
+	size := binary.Size(Header{})
+
+	if len(b) < size+binary.Size(SyncPayload{}) || !bytes.Equal(b[:4], []byte("SYNC")) {
+		return
+	}
+
+	binary.LittleEndian.PutUint64(b[size+16:], uint64(C.os_gettime_ns()))
+}
+
+// sendSync starts a clock exchange with the sender.
+func sendSync(c net.Conn) error {
+	_, err := c.Write(syncPacket(SyncPayload{
+		Originate: uint64(C.os_gettime_ns()),
+	}))
+
+	return err
+}
+
+// ClockSyncAdd feeds a reply of the sender that arrived at local time
+// arrival.
+func (s *ClockSync) ClockSyncAdd(j SyncPayload, arrival uint64) {
+	delay := time.Duration(int64(arrival-j.Originate) - int64(j.Transmit-j.Receive))
+	if delay < 0 {
+		return
+	}
+
+	offset := (int64(j.Receive-j.Originate) + int64(j.Transmit-arrival)) / 2
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.samples = append(s.samples, clockSample{
+		offset: offset,
+		delay:  delay,
+	})
+	if len(s.samples) > clockSyncSamples {
+		s.samples = s.samples[1:]
+	}
+
+	best := s.samples[0]
+	for _, sample := range s.samples {
+		if sample.delay < best.delay {
+			best = sample
+		}
+	}
+
+	s.offset = best.offset
+	s.delay = best.delay
+	s.valid = true
+}
+
+// ClockSyncReset forgets all measurements, e.g. after a reconnect.
+func (s *ClockSync) ClockSyncReset() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.samples = nil
+	s.valid = false
+}
+
+// ClockSyncOffset returns how far the sender's clock is ahead of the local
+// one and the round trip time it was measured with.
+func (s *ClockSync) ClockSyncOffset() (int64, time.Duration, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.offset, s.delay, s.valid
+}
+
+// ClockSyncToLocal maps a time of the sender's clock onto the local one.
+func (s *ClockSync) ClockSyncToLocal(t uint64) (uint64, bool) {
+	offset, _, ok := s.ClockSyncOffset()
+	if !ok {
+		return 0, false
+	}
+
+	return t - uint64(offset), true
+}
@@ -0,0 +1,62 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type Decimator struct {
+	sync.Mutex
+	next uint64
+}
+
+// DecimatorAccept reports whether the frame at timestamp should be encoded
+// to stay within fps frames per second. Accepted frames are picked from a
+// fixed time grid so the average spacing matches the target rate, even if
+// it does not divide the source rate evenly.
+func (d *Decimator) DecimatorAccept(timestamp uint64, fps int) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	if fps <= 0 {
+		d.next = 0
+		return true
+	}
+
+	interval := uint64(time.Second) / uint64(fps)
+
+	// (re)start the grid on the first frame or on timestamp discontinuities
+	if d.next == 0 || timestamp+2*interval < d.next || timestamp > d.next+interval {
+		d.next = timestamp + interval
+		return true
+	}
+
+	// tolerate some timestamp jitter around the grid
+	if timestamp+interval/4 < d.next {
+		return false
+	}
+
+	d.next += interval
+
+	return true
+}
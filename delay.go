@@ -0,0 +1,122 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+//
+import "C"
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// delayMaxSize bounds the memory held by a delay buffer. Beyond that the
+// oldest packets are released early.
+const delayMaxSize = 512 << 20
+
+// DelayBuffer holds compressed packets for a fixed delay. Packets are
+// released by their timestamp, mapped onto the local clock with the
+// smallest transit time seen, so audio and video stay together.
+type DelayBuffer struct {
+	sync.Mutex
+	packets []*Packet
+	size    int
+	transit int64
+	valid   bool
+	warned  bool
+	signal  chan any
+}
+
+// DelayBufferReset drops all held packets.
+func (d *DelayBuffer) DelayBufferReset() {
+	d.Lock()
+	defer d.Unlock()
+
+	d.packets = nil
+	d.size = 0
+	d.valid = false
+	d.warned = false
+
+	if d.signal == nil {
+		d.signal = make(chan any, 1)
+	}
+}
+
+// DelayBufferPush adds the packet p as it arrived from the network.
+func (d *DelayBuffer) DelayBufferPush(p *Packet) {
+	d.Lock()
+	defer d.Unlock()
+
+	transit := int64(p.Arrival - p.Header.Timestamp)
+	if !d.valid || transit < d.transit {
+		d.transit = transit
+		d.valid = true
+	}
+
+	d.packets = append(d.packets, p)
+	d.size += len(p.Buffer)
+
+	select {
+	case d.signal <- nil:
+	default:
+	}
+}
+
+// DelayBufferPop returns the next packet that is due at local time now.
+// Otherwise it returns how long to wait for it.
+func (d *DelayBuffer) DelayBufferPop(now uint64, delay time.Duration) (*Packet, time.Duration) {
+	d.Lock()
+	defer d.Unlock()
+
+	if len(d.packets) == 0 {
+		return nil, time.Second
+	}
+
+	p := d.packets[0]
+
+	due := p.Header.Timestamp + uint64(d.transit) + uint64(delay)
+	if int64(due-now) > 0 && d.size <= delayMaxSize {
+		return nil, time.Duration(due - now)
+	}
+
+	if d.size > delayMaxSize && !d.warned {
+		blog(C.LOG_WARNING, "delay buffer exceeded "+strconv.Itoa(delayMaxSize>>20)+" MiB, releasing packets early")
+		d.warned = true
+	}
+
+	d.packets[0] = nil
+	d.packets = d.packets[1:]
+	d.size -= len(p.Buffer)
+
+	p.Delayed = time.Duration(int64(now - p.Arrival))
+
+	return p, 0
+}
+
+// DelayBufferSignal fires whenever a packet was added.
+func (d *DelayBuffer) DelayBufferSignal() chan any {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.signal
+}
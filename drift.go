@@ -0,0 +1,164 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	driftWindow    = 10 * time.Second
+	driftWindows   = 30
+	driftMaxPPM    = 1000
+	driftSmoothing = 0.2
+	driftDeadBand  = 2
+)
+
+type driftPoint struct {
+	x float64
+	y float64
+}
+
+// DriftEstimator tracks the rate of the sender's clock relative to the
+// local one. Network delay only ever adds to the arrival time, so the
+// minimum offset of every window is used as a jitter free sample and the
+// drift is the slope of a line fitted through those.
+type DriftEstimator struct {
+	windowStart uint64
+	windowMin   int64
+	windowSize  int
+	points      []driftPoint
+	ratio       float64
+	inBase      uint64
+	outBase     uint64
+	mapped      bool
+}
+
+func (d *DriftEstimator) reset() {
+	d.windowSize = 0
+	d.points = nil
+}
+
+// DriftEstimatorAdd feeds the sender timestamp of a packet together with
+// the local time it arrived at.
+func (d *DriftEstimator) DriftEstimatorAdd(timestamp uint64, arrival uint64) {
+	offset := int64(arrival - timestamp)
+
+	if d.windowSize > 0 && time.Duration(math.Abs(float64(offset-d.windowMin))) > time.Second {
+		// clock jump or reconnect, the old samples don't apply anymore
+		d.reset()
+	}
+
+	if d.windowSize == 0 {
+		d.windowStart = timestamp
+		d.windowMin = offset
+	}
+
+	d.windowMin = min(d.windowMin, offset)
+	d.windowSize++
+
+	if time.Duration(timestamp-d.windowStart) < driftWindow {
+		return
+	}
+
+	d.points = append(d.points, driftPoint{
+		x: float64(d.windowStart),
+		y: float64(d.windowMin),
+	})
+	if len(d.points) > driftWindows {
+		d.points = d.points[1:]
+	}
+
+	d.windowSize = 0
+
+	if len(d.points) < 3 {
+		return
+	}
+
+	// least squares fit, relative to the first point to keep precision
+	var sx, sy, sxx, sxy float64
+
+	for _, p := range d.points {
+		x := p.x - d.points[0].x
+		y := p.y - d.points[0].y
+
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+
+	n := float64(len(d.points))
+
+	det := n*sxx - sx*sx
+	if det == 0 {
+		return
+	}
+
+	slope := (n*sxy - sx*sy) / det
+	slope = min(max(slope, -driftMaxPPM/1e6), driftMaxPPM/1e6)
+
+	if d.ratio == 0 {
+		d.ratio = 1
+	}
+
+	d.ratio += (1 + slope - d.ratio) * driftSmoothing
+}
+
+// DriftRatio returns how many local seconds pass per sender second.
+func (d *DriftEstimator) DriftRatio() float64 {
+	// clocks this close are left alone rather than resampled for nothing
+	if d.ratio == 0 || math.Abs(d.ratio-1)*1e6 < driftDeadBand {
+		return 1
+	}
+
+	return d.ratio
+}
+
+// DriftPPM returns the estimated drift in parts per million.
+func (d *DriftEstimator) DriftPPM() float64 {
+	if d.ratio == 0 {
+		return 0
+	}
+
+	return (d.ratio - 1) * 1e6
+}
+
+// DriftTimestamp maps a sender timestamp onto a time line running at the
+// local clock rate. The mapping is piecewise linear, so changes of the
+// estimate never make the timestamps jump.
+func (d *DriftEstimator) DriftTimestamp(timestamp uint64) uint64 {
+	if !d.mapped {
+		d.inBase = timestamp
+		d.outBase = timestamp
+		d.mapped = true
+	}
+
+	out := d.outBase + uint64(int64(math.Round(float64(int64(timestamp-d.inBase))*d.DriftRatio())))
+
+	if timestamp > d.inBase {
+		d.inBase = timestamp
+		d.outBase = out
+	}
+
+	return out
+}
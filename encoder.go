@@ -0,0 +1,186 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+// #include <util/platform.h>
+//
+import "C"
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// VideoSettings are the sender settings for outgoing video.
+type VideoSettings struct {
+	Quality      int
+	Bitrate      int
+	Scale        ScaleSettings
+	MaxFPS       int
+	Backlog      time.Duration
+	Calibration  bool
+	Timecode     int
+	TimecodeDrop bool
+	Variants     []Variant
+}
+
+// VideoEncoder encodes frames to JPEG in the background and sends them in
+// timestamp order. The filter and the output share it, they only differ in
+// how they get at the image.
+type VideoEncoder struct {
+	RateControl
+	Decimator
+	EncoderBacklog
+	CalibrationSignal
+	TimecodeGenerator
+	pool      *Pool
+	queueLock sync.Mutex
+	queue     []*Packet
+	encoding  sync.WaitGroup
+}
+
+// VideoEncoderAccept returns a packet for the frame at timestamp, or nil if
+// the frame is decimated, nobody subscribed to it or the encoder is too far
+// behind. variants and main tell what to encode for the subscribers.
+func (e *VideoEncoder) VideoEncoderAccept(s *Sender, timestamp uint64, settings VideoSettings) (p *Packet, variants []Variant, main bool) {
+	if !e.DecimatorAccept(timestamp, settings.MaxFPS) {
+		return nil, nil, false
+	}
+
+	subscribed := s.SenderGetVariants(timestamp)
+	for _, v := range settings.Variants {
+		if _, ok := subscribed[v.Name]; ok {
+			variants = append(variants, v)
+		}
+	}
+	for _, v := range subscribed {
+		if v != nil {
+			variants = append(variants, *v)
+		}
+	}
+	_, main = subscribed[""]
+
+	if !main && len(variants) == 0 {
+		return nil, nil, false
+	}
+
+	e.queueLock.Lock()
+	waiting := time.Duration(0)
+	if len(e.queue) > 0 {
+		// signed, timestamps may go back after a reset
+		waiting = max(time.Duration(int64(timestamp-e.queue[0].Header.Timestamp)), 0)
+	}
+	e.queueLock.Unlock()
+
+	if !e.EncoderBacklogAccept(waiting, settings.Backlog) {
+		return nil, nil, false
+	}
+
+	p = &Packet{
+		Header: Header{
+			Timestamp: timestamp,
+		},
+		ImageHeader: ImageHeader{
+			Capture: uint64(C.os_gettime_ns()),
+		},
+		Quality:     settings.Quality,
+		ImageBuffer: e.pool.Get().(*bytes.Buffer),
+	}
+
+	if settings.Bitrate > 0 {
+		p.Quality = e.RateControlQuality()
+		p.Bitrate = settings.Bitrate
+	}
+
+	return p, variants, main
+}
+
+// VideoEncoderEncode stamps the image of p and encodes it in the background.
+// Packets are sent in timestamp order once they and all before are done.
+func (e *VideoEncoder) VideoEncoderEncode(s *Sender, p *Packet, settings VideoSettings, variants []Variant, main bool) {
+	if settings.Calibration {
+		e.CalibrationSignalFrame(p)
+	}
+
+	var ovi C.struct_obs_video_info
+	if C.obs_get_video_info(&ovi) {
+		p.ImageHeader.Timecode = e.TimecodeGeneratorNext(p.Header.Timestamp, settings.Timecode, settings.TimecodeDrop, uint32(ovi.fps_num), uint32(ovi.fps_den))
+	}
+
+	e.queueLock.Lock()
+	e.queue = append(e.queue, p)
+
+	queueSize := time.Duration(int64(e.queue[len(e.queue)-1].Header.Timestamp - e.queue[0].Header.Timestamp))
+
+	if queueSize > time.Second {
+		blog(C.LOG_WARNING, "encoder queue exceeded: "+queueSize.String())
+	}
+	e.queueLock.Unlock()
+
+	e.encoding.Add(1)
+	go func() {
+		defer e.encoding.Done()
+
+		p.ToScaled(e.pool, settings.Scale)
+		p.ToVariants(e.pool, variants, settings.Scale.Algorithm)
+
+		if main {
+			p.ToJPEG(e.pool)
+		}
+
+		e.queueLock.Lock()
+		defer e.queueLock.Unlock()
+
+		p.DoneProcessing = true
+
+		for len(e.queue) > 0 && e.queue[0].DoneProcessing {
+			// in timestamp order, the controller measures over a time window
+			if e.queue[0].Bitrate > 0 && e.queue[0].Buffer != nil {
+				e.RateControlUpdate(e.queue[0])
+			}
+
+			for _, v := range e.queue[0].Packets() {
+				if v.Buffer != nil {
+					s.SenderSendVariant(v.Variant, v.Buffer)
+				}
+				if v.ImageBuffer != nil {
+					e.pool.Put(v.ImageBuffer)
+				}
+			}
+
+			e.queue[0] = nil
+			e.queue = e.queue[1:]
+		}
+	}()
+}
+
+// VideoEncoderRelease returns the image buffer of a packet that is not
+// encoded after all.
+func (e *VideoEncoder) VideoEncoderRelease(p *Packet) {
+	e.pool.Put(p.ImageBuffer)
+}
+
+// VideoEncoderWait waits for all frames under way to be encoded and sent.
+func (e *VideoEncoder) VideoEncoderWait() {
+	e.encoding.Wait()
+}
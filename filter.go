@@ -22,33 +22,30 @@ package main
 
 //
 // #include <obs-module.h>
+// #include <util/platform.h>
 // #include <util/dstr.h>
 //
 // extern bool filter_apply_clicked(obs_properties_t *props, obs_property_t *property, uintptr_t data);
-// extern bool quality_warning_callback(obs_properties_t *properties, obs_property_t *prop, obs_data_t *settings);
 //
 import "C"
 import (
-	"bytes"
 	"image"
 	"math"
 	"net"
 	"runtime/cgo"
 	"strconv"
 	"sync"
-	"time"
 	"unsafe"
 )
 
 type teleportFilter struct {
-	sync.Mutex
 	sync.WaitGroup
 	Announcer
 	Sender
-	pool   *Pool
+	VideoEncoder
+	AudioWires
 	done   chan any
 	filter *C.obs_source_t
-	queue  []*Packet
 }
 
 //export filter_get_name
@@ -69,9 +66,11 @@ func filter_audio_get_name(type_data C.uintptr_t) *C.char {
 //export filter_create
 func filter_create(settings *C.obs_data_t, source *C.obs_source_t) C.uintptr_t {
 	h := &teleportFilter{
+		VideoEncoder: VideoEncoder{
+			pool: NewPool(10),
+		},
 		done:   make(chan any),
 		filter: source,
-		pool:   NewPool(10),
 	}
 
 	h.Add(1)
@@ -86,9 +85,12 @@ func filter_destroy(data C.uintptr_t) {
 
 	h.done <- nil
 	h.Wait()
+	h.VideoEncoderWait()
 
 	close(h.done)
 
+	h.AudioWiresClose()
+
 	cgo.Handle(data).Delete()
 }
 
@@ -111,8 +113,38 @@ func filter_get_properties(data C.uintptr_t) *C.obs_properties_t {
 	prop = C.obs_properties_add_int(properties, port_str, port_readable_str, 0, math.MaxUint16, 1)
 	C.obs_property_set_long_description(prop, port_description_str)
 
-	prop = C.obs_properties_add_int_slider(properties, quality_str, quality_readable_str, 1, 100, 1)
-	C.obs_property_set_modified_callback(prop, C.obs_property_modified_t(unsafe.Pointer(C.quality_warning_callback)))
+	info := ""
+	if data != 0 {
+		info = cgo.Handle(data).Value().(*teleportFilter).RateControlInfo()
+	}
+
+	rate_control_properties(properties, info)
+
+	scale_properties(properties)
+
+	prop = C.obs_properties_add_int(properties, max_fps_str, max_fps_readable_str, 0, 240, 1)
+	C.obs_property_int_set_suffix(prop, fps_str)
+	C.obs_property_set_long_description(prop, max_fps_description_str)
+
+	prop = C.obs_properties_add_int(properties, backlog_str, backlog_readable_str, 0, 5000, 100)
+	C.obs_property_int_set_suffix(prop, ms_str)
+	C.obs_property_set_long_description(prop, backlog_description_str)
+
+	dropped := 0
+	if data != 0 {
+		dropped = cgo.Handle(data).Value().(*teleportFilter).EncoderBacklogDropped()
+	}
+
+	dropped_properties(properties, dropped)
+
+	prop = C.obs_properties_add_bool(properties, calibration_str, calibration_readable_str)
+	C.obs_property_set_long_description(prop, calibration_description_str)
+
+	timecode_properties(properties)
+
+	variant_properties(properties)
+
+	audio_properties(properties)
 
 	C.obs_properties_add_button(properties, apply_str, apply_str, C.obs_property_clicked_t(unsafe.Pointer(C.filter_apply_clicked)))
 
@@ -127,6 +159,20 @@ func filter_get_defaults(settings *C.obs_data_t) {
 	C.obs_data_set_default_string(settings, identifier_str, empty_str)
 	C.obs_data_set_default_int(settings, port_str, 0)
 	C.obs_data_set_default_int(settings, quality_str, 90)
+	C.obs_data_set_default_int(settings, rate_control_str, rateControlQuality)
+	C.obs_data_set_default_int(settings, bitrate_str, 80)
+
+	scale_defaults(settings)
+
+	C.obs_data_set_default_int(settings, max_fps_str, 0)
+	C.obs_data_set_default_int(settings, backlog_str, 1000)
+	C.obs_data_set_default_bool(settings, calibration_str, false)
+	C.obs_data_set_default_int(settings, timecode_str, timecodeOff)
+	C.obs_data_set_default_bool(settings, timecode_drop_str, true)
+	C.obs_data_set_default_int(settings, proxy_str, 0)
+	C.obs_data_set_default_int(settings, proxy_quality_str, 60)
+
+	audio_defaults(settings)
 }
 
 //export filter_update
@@ -135,6 +181,10 @@ func filter_update(data C.uintptr_t, settings *C.obs_data_t) {
 
 	h.done <- nil
 	h.Wait()
+	h.VideoEncoderWait()
+
+	h.TimecodeGeneratorReset()
+	h.EncoderBacklogReset()
 
 	h.Add(1)
 	go filter_loop(h)
@@ -148,19 +198,18 @@ func filter_video(data C.uintptr_t, frame *C.struct_obs_source_frame) *C.struct_
 		return frame
 	}
 
-	p := &Packet{
-		Header: Header{
-			Timestamp: uint64(frame.timestamp),
-		},
-		ImageBuffer: h.pool.Get().(*bytes.Buffer),
-	}
-
 	settings := C.obs_source_get_settings(h.filter)
-	p.Quality = int(C.obs_data_get_int(settings, quality_str))
+	video := video_settings(settings)
 	C.obs_data_release(settings)
 
+	p, variants, main := h.VideoEncoderAccept(&h.Sender, uint64(frame.timestamp), video)
+	if p == nil {
+		return frame
+	}
+
 	p.ToImage(frame.width, frame.height, frame.format, frame.data)
 	if p.Image == nil {
+		h.VideoEncoderRelease(p)
 		return frame
 	}
 
@@ -178,35 +227,7 @@ func filter_video(data C.uintptr_t, frame *C.struct_obs_source_frame) *C.struct_
 		C.video_format_get_parameters(C.VIDEO_CS_SRGB, C.VIDEO_RANGE_FULL, (*C.float)(unsafe.Pointer(&p.ImageHeader.ColorMatrix[0])), (*C.float)(unsafe.Pointer(&p.ImageHeader.ColorRangeMin[0])), (*C.float)(unsafe.Pointer(&p.ImageHeader.ColorRangeMax[0])))
 	}
 
-	h.Lock()
-	h.queue = append(h.queue, p)
-
-	queueSize := time.Duration(h.queue[len(h.queue)-1].Header.Timestamp - h.queue[0].Header.Timestamp)
-
-	if queueSize > time.Second {
-		blog(C.LOG_WARNING, "encoder queue exceeded: "+queueSize.String())
-	}
-	h.Unlock()
-
-	h.Add(1)
-	go func(p *Packet) {
-		defer h.Done()
-
-		p.ToJPEG(h.pool)
-
-		h.Lock()
-		defer h.Unlock()
-
-		p.DoneProcessing = true
-
-		for len(h.queue) > 0 && h.queue[0].DoneProcessing {
-			h.SenderSend(h.queue[0].Buffer)
-			h.pool.Put(h.queue[0].ImageBuffer)
-
-			h.queue[0] = nil
-			h.queue = h.queue[1:]
-		}
-	}(p)
+	h.VideoEncoderEncode(&h.Sender, p, video, variants, main)
 
 	return frame
 }
@@ -219,22 +240,54 @@ func filter_audio(data C.uintptr_t, frames *C.struct_obs_audio_data) *C.struct_o
 		return frames
 	}
 
-	audio := C.obs_get_audio()
-	info := C.audio_output_get_info(audio) //FIXME: output??
+	info, ok := h.FilterAudioInfo()
+	if !ok {
+		return frames
+	}
 
 	p := Packet{
 		Header: Header{
 			Timestamp: uint64(frames.timestamp),
 		},
+		WaveHeader: WaveHeader{
+			Capture: uint64(C.os_gettime_ns()),
+		},
 	}
 
 	p.ToWAVE(info, frames.frames, frames.data)
 
-	h.SenderSend(p.Buffer)
+	settings := C.obs_source_get_settings(h.filter)
+	audioSettings := audio_settings(settings)
+	calibration := bool(C.obs_data_get_bool(settings, calibration_str))
+	C.obs_data_release(settings)
+
+	if calibration {
+		p.ToCalibrationTone()
+	}
+
+	h.AudioWiresSend(&h.Sender, &p, audioSettings)
 
 	return frames
 }
 
+// FilterAudioInfo describes the audio handed to the filter. Sources are
+// resampled to the mixer's sample rate and speaker layout in planar float
+// before any filter sees them, regardless of the format the source
+// produces or of what any output converts to later.
+func (h *teleportFilter) FilterAudioInfo() (AudioInfo, bool) {
+	var oai C.struct_obs_audio_info
+
+	if !C.obs_get_audio_info(&oai) {
+		return AudioInfo{}, false
+	}
+
+	return AudioInfo{
+		Format:     C.AUDIO_FORMAT_FLOAT_PLANAR,
+		Speakers:   oai.speakers,
+		SampleRate: oai.samples_per_sec,
+	}, true
+}
+
 func filter_loop(h *teleportFilter) {
 	defer h.Done()
 	defer h.SenderClose()
@@ -242,8 +295,11 @@ func filter_loop(h *teleportFilter) {
 	settings := C.obs_source_get_settings(h.filter)
 	name := C.GoString(C.obs_data_get_string(settings, identifier_str))
 	listenPort := int(C.obs_data_get_int(settings, port_str))
+	variants := variant_settings(settings)
 	C.obs_data_release(settings)
 
+	h.SenderSetVariants(variants)
+
 	l, err := net.Listen("tcp", ":"+strconv.Itoa(listenPort))
 	if err != nil {
 		blog(C.LOG_ERROR, "unable binding to port: "+strconv.Itoa(listenPort))
@@ -277,7 +333,7 @@ func filter_loop(h *teleportFilter) {
 		audioAndVideo = true
 	}
 
-	h.StartAnnouncer(name, port, audioAndVideo)
+	h.StartAnnouncer(name, port, audioAndVideo, variants, nil)
 	defer h.StopAnnouncer()
 
 	<-h.done
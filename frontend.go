@@ -28,32 +28,138 @@ package main
 // extern void frontend_cb(uintptr_t data);
 // extern bool enabled_warning_callback(obs_properties_t *properties, obs_property_t *prop, obs_data_t *settings);
 // extern bool quality_warning_callback(obs_properties_t *properties, obs_property_t *prop, obs_data_t *settings);
+// extern bool rate_control_callback(obs_properties_t *properties, obs_property_t *prop, obs_data_t *settings);
+// extern bool audio_codec_callback(obs_properties_t *properties, obs_property_t *prop, obs_data_t *settings);
 //
 import "C"
 import (
 	"math"
 	"runtime/cgo"
+	"strconv"
+	"time"
 	"unsafe"
 )
 
 var (
-	teleport_enabled_str          = C.CString("teleport-enabled")
-	teleport_enabled_readable_str = C.CString("Teleport Enabled")
-	enabled_warning               = C.CString("enabled-warning")
-	enabled_warning_str           = C.CString("Warning: While Teleport is enabled and a client is connected you will not be able to change OBS's output settings.")
-	identifier_str                = C.CString("identifier")
-	identifier_readable_str       = C.CString("Identifier")
-	identifier_description_str    = C.CString("Name of the stream. Uses hostname if blank.")
-	port_str                      = C.CString("port")
-	port_readable_str             = C.CString("TCP Port")
-	port_description_str          = C.CString("0 means 'auto'. If you set this I really hope you know what you are doing and how to configure your firewall.")
-	quality_str                   = C.CString("quality")
-	quality_readable_str          = C.CString("Quality")
-	quality_warning               = C.CString("quality-warning")
-	quality_warning_str           = C.CString("Warning: A quality value over 90 is not recommended! Everything above 90 will most likely increase bandwidth by a lot, with very little visual quality gains. You can still try, but you have been warned.")
-	apply_str                     = C.CString("Apply")
-	empty_str                     = C.CString("")
-	config_str                    = C.CString("obs-teleport.json")
+	teleport_enabled_str           = C.CString("teleport-enabled")
+	teleport_enabled_readable_str  = C.CString("Teleport Enabled")
+	enabled_warning                = C.CString("enabled-warning")
+	enabled_warning_str            = C.CString("Warning: While Teleport is enabled and a client is connected you will not be able to change OBS's output settings.")
+	identifier_str                 = C.CString("identifier")
+	identifier_readable_str        = C.CString("Identifier")
+	identifier_description_str     = C.CString("Name of the stream. Uses hostname if blank.")
+	port_str                       = C.CString("port")
+	port_readable_str              = C.CString("TCP Port")
+	port_description_str           = C.CString("0 means 'auto'. If you set this I really hope you know what you are doing and how to configure your firewall.")
+	quality_str                    = C.CString("quality")
+	quality_readable_str           = C.CString("Quality")
+	quality_warning                = C.CString("quality-warning")
+	quality_warning_str            = C.CString("Warning: A quality value over 90 is not recommended! Everything above 90 will most likely increase bandwidth by a lot, with very little visual quality gains. You can still try, but you have been warned.")
+	rate_control_str               = C.CString("rate_control")
+	rate_control_readable_str      = C.CString("Rate Control")
+	rate_control_quality_str       = C.CString("Constant Quality")
+	rate_control_bitrate_str       = C.CString("Target Bitrate")
+	bitrate_str                    = C.CString("bitrate")
+	bitrate_readable_str           = C.CString("Bitrate")
+	bitrate_description_str        = C.CString("The JPEG quality is adjusted for each frame to meet this bitrate.")
+	bitrate_info                   = C.CString("bitrate-info")
+	mbps_str                       = C.CString(" Mbps")
+	crop_left_str                  = C.CString("crop_left")
+	crop_left_readable_str         = C.CString("Crop Left")
+	crop_top_str                   = C.CString("crop_top")
+	crop_top_readable_str          = C.CString("Crop Top")
+	crop_right_str                 = C.CString("crop_right")
+	crop_right_readable_str        = C.CString("Crop Right")
+	crop_bottom_str                = C.CString("crop_bottom")
+	crop_bottom_readable_str       = C.CString("Crop Bottom")
+	scale_width_str                = C.CString("scale_width")
+	scale_width_readable_str       = C.CString("Output Width")
+	scale_height_str               = C.CString("scale_height")
+	scale_height_readable_str      = C.CString("Output Height")
+	scale_description_str          = C.CString("0 keeps the size after cropping. If only one of width or height is set the aspect ratio is preserved.")
+	scale_algorithm_str            = C.CString("scale_algorithm")
+	scale_algorithm_readable_str   = C.CString("Scale Filter")
+	scale_point_str                = C.CString("Point")
+	scale_bilinear_str             = C.CString("Bilinear")
+	scale_bicubic_str              = C.CString("Bicubic")
+	scale_area_str                 = C.CString("Area")
+	px_str                         = C.CString(" px")
+	max_fps_str                    = C.CString("max_fps")
+	max_fps_readable_str           = C.CString("Max. Frame Rate")
+	max_fps_description_str        = C.CString("0 means no limit. Frames above this rate are dropped before encoding.")
+	fps_str                        = C.CString(" fps")
+	backlog_str                    = C.CString("encoder_backlog")
+	backlog_readable_str           = C.CString("Max. Encoder Backlog")
+	backlog_description_str        = C.CString("0 means no limit. New frames are dropped before encoding while more video than this waits to be encoded and sent.")
+	dropped_info_str               = C.CString("dropped_info")
+	calibration_str                = C.CString("calibration")
+	calibration_readable_str       = C.CString("Calibration Signal")
+	calibration_description_str    = C.CString("Sends a flash and a beep every second instead of the picture and sound, for receivers to measure A/V sync and latency.")
+	timecode_str                   = C.CString("timecode")
+	timecode_readable_str          = C.CString("Timecode")
+	timecode_off_str               = C.CString("None")
+	timecode_time_of_day_str       = C.CString("Time of Day")
+	timecode_free_run_str          = C.CString("Free Run")
+	timecode_description_str       = C.CString("Attaches an SMPTE timecode at the OBS frame rate to every frame, for receivers to burn in or log.")
+	timecode_drop_str              = C.CString("timecode_drop")
+	timecode_drop_readable_str     = C.CString("Drop-Frame Timecode")
+	timecode_drop_description_str  = C.CString("Only applies to 29.97 and 59.94 fps.")
+	proxy_str                      = C.CString("proxy")
+	proxy_readable_str             = C.CString("Proxy Stream")
+	proxy_description_str          = C.CString("Additionally offer a scaled down copy of the stream. Receivers pick the variant they want from their stream list.")
+	proxy_disabled_str             = C.CString("Disabled")
+	proxy_quality_str              = C.CString("proxy_quality")
+	proxy_quality_readable_str     = C.CString("Proxy Quality")
+	audio_codec_str                = C.CString("audio_codec")
+	audio_codec_readable_str       = C.CString("Audio Codec")
+	audio_codec_pcm_str            = C.CString("Uncompressed (PCM)")
+	audio_codec_opus_str           = C.CString("Opus")
+	audio_codec_lossless_str       = C.CString("Lossless")
+	opus_bitrate_str               = C.CString("opus_bitrate")
+	opus_bitrate_readable_str      = C.CString("Opus Bitrate")
+	opus_frame_size_str            = C.CString("opus_frame_size")
+	opus_frame_size_readable_str   = C.CString("Opus Frame Size")
+	opus_description_str           = C.CString("Opus supports mono and stereo audio at 8, 12, 16, 24 and 48 kHz. Other formats are sent uncompressed. Lossless compression is bit exact and only used for receivers that support it.")
+	kbps_str                       = C.CString(" kbps")
+	bit_depth_str                  = C.CString("audio_bit_depth")
+	bit_depth_readable_str         = C.CString("Audio Bit Depth")
+	bit_depth_original_str         = C.CString("Original")
+	bit_depth_16_str               = C.CString("16-bit")
+	bit_depth_24_str               = C.CString("24-bit")
+	bit_depth_description_str      = C.CString("Reduced bit depths are dithered. Opus only accepts 16-bit or the original float audio.")
+	send_channels_str              = C.CString("audio_channels")
+	send_channels_readable_str     = C.CString("Audio Channels")
+	send_channels_all_str          = C.CString("All")
+	send_channels_stereo_str       = C.CString("Stereo")
+	send_channels_mono_str         = C.CString("Mono")
+	send_channels_left_str         = C.CString("Left Only")
+	send_channels_right_str        = C.CString("Right Only")
+	silence_str                    = C.CString("silence_suppression")
+	silence_readable_str           = C.CString("Silence Suppression")
+	silence_description_str        = C.CString("Audio blocks below the threshold are sent as a short note instead of samples. Receivers play them back as silence.")
+	silence_threshold_str          = C.CString("silence_threshold")
+	silence_threshold_readable_str = C.CString("Silence Threshold")
+	db_str                         = C.CString(" dB")
+
+	track_str = [C.MAX_AUDIO_MIXES]*C.char{
+		C.CString("track_1"),
+		C.CString("track_2"),
+		C.CString("track_3"),
+		C.CString("track_4"),
+		C.CString("track_5"),
+		C.CString("track_6"),
+	}
+	track_readable_str = [C.MAX_AUDIO_MIXES]*C.char{
+		C.CString("Track 1"),
+		C.CString("Track 2"),
+		C.CString("Track 3"),
+		C.CString("Track 4"),
+		C.CString("Track 5"),
+		C.CString("Track 6"),
+	}
+	apply_str  = C.CString("Apply")
+	empty_str  = C.CString("")
+	config_str = C.CString("obs-teleport.json")
 
 	output *C.obs_output_t
 	dummy  *C.obs_source_t
@@ -140,13 +246,259 @@ func quality_warning_callback(properties *C.obs_properties_t, prop *C.obs_proper
 	warning := C.obs_properties_get(properties, quality_warning)
 	visible := C.obs_property_visible(warning)
 
-	if quality > 90 {
+	show := quality > 90 && C.obs_data_get_int(settings, rate_control_str) != rateControlBitrate
+
+	if show {
 		C.obs_property_set_visible(warning, true)
 	} else {
 		C.obs_property_set_visible(warning, false)
 	}
 
-	return visible != (quality > 90)
+	return visible != C.bool(show)
+}
+
+//export rate_control_callback
+func rate_control_callback(properties *C.obs_properties_t, prop *C.obs_property_t, settings *C.obs_data_t) C.bool {
+	bitrate := C.obs_data_get_int(settings, rate_control_str) == rateControlBitrate
+
+	C.obs_property_set_visible(C.obs_properties_get(properties, quality_str), C.bool(!bitrate))
+	C.obs_property_set_visible(C.obs_properties_get(properties, bitrate_str), C.bool(bitrate))
+	C.obs_property_set_visible(C.obs_properties_get(properties, bitrate_info), C.bool(bitrate))
+
+	quality_warning_callback(properties, prop, settings)
+
+	return true
+}
+
+func rate_control_properties(properties *C.obs_properties_t, info string) {
+	prop := C.obs_properties_add_list(properties, rate_control_str, rate_control_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_list_add_int(prop, rate_control_quality_str, rateControlQuality)
+	C.obs_property_list_add_int(prop, rate_control_bitrate_str, rateControlBitrate)
+	C.obs_property_set_modified_callback(prop, C.obs_property_modified_t(unsafe.Pointer(C.rate_control_callback)))
+
+	prop = C.obs_properties_add_int_slider(properties, quality_str, quality_readable_str, 1, 100, 1)
+	C.obs_property_set_modified_callback(prop, C.obs_property_modified_t(unsafe.Pointer(C.quality_warning_callback)))
+
+	prop = C.obs_properties_add_int(properties, bitrate_str, bitrate_readable_str, 1, 1000, 1)
+	C.obs_property_int_set_suffix(prop, mbps_str)
+	C.obs_property_set_long_description(prop, bitrate_description_str)
+
+	tmp := C.CString(info)
+	C.obs_properties_add_text(properties, bitrate_info, tmp, C.OBS_TEXT_INFO)
+	C.free(unsafe.Pointer(tmp))
+}
+
+func scale_properties(properties *C.obs_properties_t) {
+	for _, crop := range [][2]*C.char{
+		{crop_left_str, crop_left_readable_str},
+		{crop_top_str, crop_top_readable_str},
+		{crop_right_str, crop_right_readable_str},
+		{crop_bottom_str, crop_bottom_readable_str},
+	} {
+		prop := C.obs_properties_add_int(properties, crop[0], crop[1], 0, 16384, 2)
+		C.obs_property_int_set_suffix(prop, px_str)
+	}
+
+	prop := C.obs_properties_add_int(properties, scale_width_str, scale_width_readable_str, 0, 16384, 2)
+	C.obs_property_int_set_suffix(prop, px_str)
+	C.obs_property_set_long_description(prop, scale_description_str)
+
+	prop = C.obs_properties_add_int(properties, scale_height_str, scale_height_readable_str, 0, 16384, 2)
+	C.obs_property_int_set_suffix(prop, px_str)
+	C.obs_property_set_long_description(prop, scale_description_str)
+
+	prop = C.obs_properties_add_list(properties, scale_algorithm_str, scale_algorithm_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_list_add_int(prop, scale_point_str, scalePoint)
+	C.obs_property_list_add_int(prop, scale_bilinear_str, scaleBilinear)
+	C.obs_property_list_add_int(prop, scale_bicubic_str, scaleBicubic)
+	C.obs_property_list_add_int(prop, scale_area_str, scaleArea)
+}
+
+func scale_defaults(settings *C.obs_data_t) {
+	C.obs_data_set_default_int(settings, crop_left_str, 0)
+	C.obs_data_set_default_int(settings, crop_top_str, 0)
+	C.obs_data_set_default_int(settings, crop_right_str, 0)
+	C.obs_data_set_default_int(settings, crop_bottom_str, 0)
+	C.obs_data_set_default_int(settings, scale_width_str, 0)
+	C.obs_data_set_default_int(settings, scale_height_str, 0)
+	C.obs_data_set_default_int(settings, scale_algorithm_str, scaleBicubic)
+}
+
+func scale_settings(settings *C.obs_data_t) ScaleSettings {
+	return ScaleSettings{
+		CropLeft:   int(C.obs_data_get_int(settings, crop_left_str)),
+		CropTop:    int(C.obs_data_get_int(settings, crop_top_str)),
+		CropRight:  int(C.obs_data_get_int(settings, crop_right_str)),
+		CropBottom: int(C.obs_data_get_int(settings, crop_bottom_str)),
+		Width:      int(C.obs_data_get_int(settings, scale_width_str)),
+		Height:     int(C.obs_data_get_int(settings, scale_height_str)),
+		Algorithm:  int(C.obs_data_get_int(settings, scale_algorithm_str)),
+	}
+}
+
+func video_settings(settings *C.obs_data_t) VideoSettings {
+	v := VideoSettings{
+		Quality:      int(C.obs_data_get_int(settings, quality_str)),
+		Scale:        scale_settings(settings),
+		MaxFPS:       int(C.obs_data_get_int(settings, max_fps_str)),
+		Backlog:      time.Duration(C.obs_data_get_int(settings, backlog_str)) * time.Millisecond,
+		Calibration:  bool(C.obs_data_get_bool(settings, calibration_str)),
+		Timecode:     int(C.obs_data_get_int(settings, timecode_str)),
+		TimecodeDrop: bool(C.obs_data_get_bool(settings, timecode_drop_str)),
+		Variants:     variant_settings(settings),
+	}
+
+	if C.obs_data_get_int(settings, rate_control_str) == rateControlBitrate {
+		v.Bitrate = int(C.obs_data_get_int(settings, bitrate_str))
+	}
+
+	return v
+}
+
+func variant_properties(properties *C.obs_properties_t) {
+	prop := C.obs_properties_add_list(properties, proxy_str, proxy_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_set_long_description(prop, proxy_description_str)
+	C.obs_property_list_add_int(prop, proxy_disabled_str, 0)
+
+	for _, height := range []int{360, 480, 540, 720} {
+		tmp := C.CString(strconv.Itoa(height) + "p")
+		C.obs_property_list_add_int(prop, tmp, C.longlong(height))
+		C.free(unsafe.Pointer(tmp))
+	}
+
+	C.obs_properties_add_int_slider(properties, proxy_quality_str, proxy_quality_readable_str, 1, 100, 1)
+}
+
+func variant_settings(settings *C.obs_data_t) []Variant {
+	height := int(C.obs_data_get_int(settings, proxy_str))
+	if height == 0 {
+		return nil
+	}
+
+	return []Variant{
+		{
+			Name:    "proxy",
+			Height:  height,
+			Quality: int(C.obs_data_get_int(settings, proxy_quality_str)),
+		},
+	}
+}
+
+//export audio_codec_callback
+func audio_codec_callback(properties *C.obs_properties_t, prop *C.obs_property_t, settings *C.obs_data_t) C.bool {
+	opus := C.obs_data_get_int(settings, audio_codec_str) == audioCodecOpus
+
+	C.obs_property_set_visible(C.obs_properties_get(properties, opus_bitrate_str), C.bool(opus))
+	C.obs_property_set_visible(C.obs_properties_get(properties, opus_frame_size_str), C.bool(opus))
+
+	return true
+}
+
+func dropped_properties(properties *C.obs_properties_t, dropped int) {
+	tmp := C.CString("Dropped Frames: " + strconv.Itoa(dropped))
+	C.obs_properties_add_text(properties, dropped_info_str, tmp, C.OBS_TEXT_INFO)
+	C.free(unsafe.Pointer(tmp))
+}
+
+func timecode_properties(properties *C.obs_properties_t) {
+	prop := C.obs_properties_add_list(properties, timecode_str, timecode_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_set_long_description(prop, timecode_description_str)
+	C.obs_property_list_add_int(prop, timecode_off_str, timecodeOff)
+	C.obs_property_list_add_int(prop, timecode_time_of_day_str, timecodeTimeOfDay)
+	C.obs_property_list_add_int(prop, timecode_free_run_str, timecodeFreeRun)
+
+	prop = C.obs_properties_add_bool(properties, timecode_drop_str, timecode_drop_readable_str)
+	C.obs_property_set_long_description(prop, timecode_drop_description_str)
+}
+
+func audio_properties(properties *C.obs_properties_t) {
+	prop := C.obs_properties_add_list(properties, audio_codec_str, audio_codec_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_set_long_description(prop, opus_description_str)
+	C.obs_property_list_add_int(prop, audio_codec_pcm_str, audioCodecPCM)
+	C.obs_property_list_add_int(prop, audio_codec_opus_str, audioCodecOpus)
+	C.obs_property_list_add_int(prop, audio_codec_lossless_str, audioCodecLossless)
+	C.obs_property_set_modified_callback(prop, C.obs_property_modified_t(unsafe.Pointer(C.audio_codec_callback)))
+
+	prop = C.obs_properties_add_int(properties, opus_bitrate_str, opus_bitrate_readable_str, 6, 510, 1)
+	C.obs_property_int_set_suffix(prop, kbps_str)
+
+	prop = C.obs_properties_add_list(properties, opus_frame_size_str, opus_frame_size_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+
+	for _, size := range []time.Duration{2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond} {
+		tmp := C.CString(size.String())
+		C.obs_property_list_add_int(prop, tmp, C.longlong(size.Microseconds()))
+		C.free(unsafe.Pointer(tmp))
+	}
+
+	prop = C.obs_properties_add_list(properties, bit_depth_str, bit_depth_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_set_long_description(prop, bit_depth_description_str)
+	C.obs_property_list_add_int(prop, bit_depth_original_str, bitDepthOriginal)
+	C.obs_property_list_add_int(prop, bit_depth_16_str, bitDepth16)
+	C.obs_property_list_add_int(prop, bit_depth_24_str, bitDepth24)
+
+	prop = C.obs_properties_add_list(properties, send_channels_str, send_channels_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_list_add_int(prop, send_channels_all_str, sendChannelsAll)
+	C.obs_property_list_add_int(prop, send_channels_stereo_str, sendChannelsStereo)
+	C.obs_property_list_add_int(prop, send_channels_mono_str, sendChannelsMono)
+	C.obs_property_list_add_int(prop, send_channels_left_str, sendChannelsLeft)
+	C.obs_property_list_add_int(prop, send_channels_right_str, sendChannelsRight)
+
+	prop = C.obs_properties_add_bool(properties, silence_str, silence_readable_str)
+	C.obs_property_set_long_description(prop, silence_description_str)
+
+	prop = C.obs_properties_add_int_slider(properties, silence_threshold_str, silence_threshold_readable_str, -120, -20, 1)
+	C.obs_property_int_set_suffix(prop, db_str)
+}
+
+func audio_defaults(settings *C.obs_data_t) {
+	C.obs_data_set_default_int(settings, audio_codec_str, audioCodecPCM)
+	C.obs_data_set_default_int(settings, opus_bitrate_str, 160)
+	C.obs_data_set_default_int(settings, opus_frame_size_str, 20000)
+	C.obs_data_set_default_int(settings, bit_depth_str, bitDepthOriginal)
+	C.obs_data_set_default_int(settings, send_channels_str, sendChannelsAll)
+	C.obs_data_set_default_bool(settings, silence_str, false)
+	C.obs_data_set_default_int(settings, silence_threshold_str, -90)
+}
+
+func audio_settings(settings *C.obs_data_t) AudioSettings {
+	return AudioSettings{
+		Codec:            int(C.obs_data_get_int(settings, audio_codec_str)),
+		Bitrate:          int(C.obs_data_get_int(settings, opus_bitrate_str)),
+		FrameSize:        time.Duration(C.obs_data_get_int(settings, opus_frame_size_str)) * time.Microsecond,
+		Depth:            int(C.obs_data_get_int(settings, bit_depth_str)),
+		SendChannels:     int(C.obs_data_get_int(settings, send_channels_str)),
+		Silence:          bool(C.obs_data_get_bool(settings, silence_str)),
+		SilenceThreshold: float64(C.obs_data_get_int(settings, silence_threshold_str)),
+	}
+}
+
+func track_properties(properties *C.obs_properties_t) {
+	for i := range track_str {
+		C.obs_properties_add_bool(properties, track_str[i], track_readable_str[i])
+	}
+}
+
+func track_defaults(settings *C.obs_data_t) {
+	for i := range track_str {
+		C.obs_data_set_default_bool(settings, track_str[i], i == 0)
+	}
+}
+
+// track_settings returns the selected tracks, at least the first one.
+func track_settings(settings *C.obs_data_t) []int {
+	var tracks []int
+
+	for i := range track_str {
+		if C.obs_data_get_bool(settings, track_str[i]) {
+			tracks = append(tracks, i)
+		}
+	}
+
+	if len(tracks) == 0 {
+		tracks = []int{0}
+	}
+
+	return tracks
 }
 
 //export dummy_get_properties
@@ -164,8 +516,30 @@ func dummy_get_properties(data C.uintptr_t) *C.obs_properties_t {
 	prop = C.obs_properties_add_int(properties, port_str, port_readable_str, 0, math.MaxUint16, 1)
 	C.obs_property_set_long_description(prop, port_description_str)
 
-	prop = C.obs_properties_add_int_slider(properties, quality_str, quality_readable_str, 1, 100, 1)
-	C.obs_property_set_modified_callback(prop, C.obs_property_modified_t(unsafe.Pointer(C.quality_warning_callback)))
+	rate_control_properties(properties, outputRateControlInfo())
+
+	scale_properties(properties)
+
+	prop = C.obs_properties_add_int(properties, max_fps_str, max_fps_readable_str, 0, 240, 1)
+	C.obs_property_int_set_suffix(prop, fps_str)
+	C.obs_property_set_long_description(prop, max_fps_description_str)
+
+	prop = C.obs_properties_add_int(properties, backlog_str, backlog_readable_str, 0, 5000, 100)
+	C.obs_property_int_set_suffix(prop, ms_str)
+	C.obs_property_set_long_description(prop, backlog_description_str)
+
+	dropped_properties(properties, outputDroppedFrames())
+
+	prop = C.obs_properties_add_bool(properties, calibration_str, calibration_readable_str)
+	C.obs_property_set_long_description(prop, calibration_description_str)
+
+	timecode_properties(properties)
+
+	variant_properties(properties)
+
+	audio_properties(properties)
+
+	track_properties(properties)
 
 	prop = C.obs_properties_add_text(properties, enabled_warning, enabled_warning_str, C.OBS_TEXT_INFO)
 	C.obs_property_text_set_info_type(prop, C.OBS_TEXT_INFO_WARNING)
@@ -182,6 +556,22 @@ func dummy_get_defaults(settings *C.obs_data_t) {
 	C.obs_data_set_default_string(settings, identifier_str, empty_str)
 	C.obs_data_set_default_int(settings, port_str, 0)
 	C.obs_data_set_default_int(settings, quality_str, 90)
+	C.obs_data_set_default_int(settings, rate_control_str, rateControlQuality)
+	C.obs_data_set_default_int(settings, bitrate_str, 80)
+
+	scale_defaults(settings)
+
+	C.obs_data_set_default_int(settings, max_fps_str, 0)
+	C.obs_data_set_default_int(settings, backlog_str, 1000)
+	C.obs_data_set_default_bool(settings, calibration_str, false)
+	C.obs_data_set_default_int(settings, timecode_str, timecodeOff)
+	C.obs_data_set_default_bool(settings, timecode_drop_str, true)
+	C.obs_data_set_default_int(settings, proxy_str, 0)
+	C.obs_data_set_default_int(settings, proxy_quality_str, 60)
+
+	audio_defaults(settings)
+
+	track_defaults(settings)
 }
 
 //export dummy_update
@@ -0,0 +1,162 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	jitterWindow    = 10 * time.Second
+	jitterMargin    = 10 * time.Millisecond
+	jitterMaxDelay  = 2 * time.Second
+	jitterShrinkMax = 100 * time.Microsecond
+)
+
+type jitterTransit struct {
+	time    uint64
+	transit int64
+}
+
+// JitterBuffer holds decoded packets back until their timestamp is due,
+// so network jitter doesn't reach OBS as stutter. Every packet is played
+// out at its timestamp plus the smallest transit time seen recently plus
+// a delay. The delay is the target latency, or more if the observed spread
+// of transit times calls for it.
+type JitterBuffer struct {
+	sync.Mutex
+	target   time.Duration
+	delay    time.Duration
+	packets  []*Packet
+	transits []jitterTransit
+	signal   chan any
+}
+
+// JitterBufferReset empties the buffer and sets a new target latency.
+// A target of 0 disables the buffer.
+func (j *JitterBuffer) JitterBufferReset(target time.Duration) {
+	j.Lock()
+	defer j.Unlock()
+
+	j.target = target
+	j.delay = target
+	j.packets = nil
+	j.transits = nil
+
+	if j.signal == nil {
+		j.signal = make(chan any, 1)
+	}
+}
+
+func (j *JitterBuffer) JitterBufferEnabled() bool {
+	j.Lock()
+	defer j.Unlock()
+
+	return j.target > 0
+}
+
+// JitterBufferPush adds the packet p that became ready at local time now.
+func (j *JitterBuffer) JitterBufferPush(p *Packet, now uint64) {
+	j.Lock()
+	defer j.Unlock()
+
+	j.transits = append(j.transits, jitterTransit{
+		time:    now,
+		transit: int64(now - p.Header.Timestamp),
+	})
+
+	for len(j.transits) > 0 && time.Duration(now-j.transits[0].time) > jitterWindow {
+		j.transits = j.transits[1:]
+	}
+
+	lo, hi := j.transitRange()
+
+	desired := min(max(j.target, time.Duration(hi-lo)+jitterMargin), jitterMaxDelay)
+	if desired > j.delay {
+		j.delay = desired
+	}
+
+	i := sort.Search(len(j.packets), func(i int) bool {
+		return j.packets[i].Header.Timestamp > p.Header.Timestamp
+	})
+	j.packets = append(j.packets, nil)
+	copy(j.packets[i+1:], j.packets[i:])
+	j.packets[i] = p
+
+	select {
+	case j.signal <- nil:
+	default:
+	}
+}
+
+func (j *JitterBuffer) transitRange() (int64, int64) {
+	lo := int64(math.MaxInt64)
+	hi := int64(math.MinInt64)
+
+	for _, t := range j.transits {
+		lo = min(lo, t.transit)
+		hi = max(hi, t.transit)
+	}
+
+	return lo, hi
+}
+
+// JitterBufferPop returns the next packet that is due at local time now.
+// Otherwise it returns how long to wait for the next one.
+func (j *JitterBuffer) JitterBufferPop(now uint64) (*Packet, time.Duration) {
+	j.Lock()
+	defer j.Unlock()
+
+	if len(j.packets) == 0 {
+		return nil, time.Second
+	}
+
+	lo, hi := j.transitRange()
+
+	// calm network, slowly give back latency that isn't needed anymore
+	desired := min(max(j.target, time.Duration(hi-lo)+jitterMargin), jitterMaxDelay)
+	if desired < j.delay {
+		j.delay -= min(j.delay-desired, jitterShrinkMax)
+	}
+
+	p := j.packets[0]
+
+	due := p.Header.Timestamp + uint64(lo) + uint64(j.delay)
+	if int64(due-now) > 0 {
+		return nil, time.Duration(due - now)
+	}
+
+	j.packets[0] = nil
+	j.packets = j.packets[1:]
+
+	return p, 0
+}
+
+// JitterBufferSignal fires whenever a packet was added.
+func (j *JitterBuffer) JitterBufferSignal() chan any {
+	j.Lock()
+	defer j.Unlock()
+
+	return j.signal
+}
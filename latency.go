@@ -0,0 +1,178 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+// #include <util/platform.h>
+//
+import "C"
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	latencyEncode = iota
+	latencyNetwork
+	latencyDecode
+	latencyPresentation
+	latencyVideo
+	latencyAudio
+	latencyStages
+)
+
+var latencyNames = [latencyStages]string{
+	"Encode",
+	"Network",
+	"Decode",
+	"Presentation",
+	"Video Total",
+	"Audio Total",
+}
+
+const latencyWindow = 10 * time.Second
+
+// stampEncoded sets the time a JPEG packet starts going out to the network,
+// right in the serialized ImageHeader. Like stampSync it is called by the
+// writer, so time spent in the send queue doesn't count as network delay.
+func stampEncoded(b []byte) {
+	offset := binary.Size(Header{}) + binary.Size(ImageHeader{}) - 8
+
+	if len(b) < offset+8 || string(b[:4]) != "JPEG" {
+		return
+	}
+
+	binary.LittleEndian.PutUint64(b[offset:], uint64(C.os_gettime_ns()))
+}
+
+type latencySample struct {
+	time  uint64
+	delay time.Duration
+}
+
+// LatencyStats keeps the delays of the different stages of the last few
+// seconds for a rolling min/mean/max report.
+type LatencyStats struct {
+	sync.Mutex
+	stages  [latencyStages][]latencySample
+	lastLog uint64
+}
+
+func (l *LatencyStats) add(stage int, now uint64, delay time.Duration) {
+	samples := append(l.stages[stage], latencySample{
+		time:  now,
+		delay: delay,
+	})
+
+	for len(samples) > 0 && time.Duration(now-samples[0].time) > latencyWindow {
+		samples = samples[1:]
+	}
+
+	l.stages[stage] = samples
+}
+
+// LatencyStatsAdd records the delays of packet p, which is presented right
+// now. Everything measured against the sender's clock needs a clock sync.
+func (l *LatencyStats) LatencyStatsAdd(p *Packet, clock *ClockSync) {
+	now := uint64(C.os_gettime_ns())
+
+	l.Lock()
+	defer l.Unlock()
+
+	if p.IsAudio {
+		if capture, ok := clock.ClockSyncToLocal(p.WaveHeader.Capture); ok && p.WaveHeader.Capture != 0 {
+			l.add(latencyAudio, now, time.Duration(int64(now-capture)))
+		}
+	} else {
+		if p.ImageHeader.Capture != 0 && p.ImageHeader.Encoded != 0 {
+			l.add(latencyEncode, now, time.Duration(int64(p.ImageHeader.Encoded-p.ImageHeader.Capture)))
+
+			if encoded, ok := clock.ClockSyncToLocal(p.ImageHeader.Encoded); ok {
+				l.add(latencyNetwork, now, time.Duration(int64(p.Arrival-encoded)))
+			}
+			if capture, ok := clock.ClockSyncToLocal(p.ImageHeader.Capture); ok {
+				l.add(latencyVideo, now, time.Duration(int64(now-capture)))
+			}
+		}
+
+		l.add(latencyDecode, now, time.Duration(int64(p.Decoded-p.Arrival))-p.Delayed)
+		l.add(latencyPresentation, now, time.Duration(int64(now-p.Decoded)))
+	}
+
+	if time.Duration(now-l.lastLog) > latencyWindow {
+		l.lastLog = now
+		blog(C.LOG_DEBUG, l.latencyString())
+	}
+}
+
+// LatencyStatsReset drops all samples, e.g. after a reconnect.
+func (l *LatencyStats) LatencyStatsReset() {
+	l.Lock()
+	defer l.Unlock()
+
+	l.stages = [latencyStages][]latencySample{}
+}
+
+// LatencyStatsInfo returns min, mean and max of every stage.
+func (l *LatencyStats) LatencyStatsInfo() string {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.latencyString()
+}
+
+func (l *LatencyStats) latencyString() string {
+	var lines []string
+
+	for stage, samples := range l.stages {
+		if len(samples) == 0 {
+			continue
+		}
+
+		lo := samples[0].delay
+		hi := samples[0].delay
+		sum := time.Duration(0)
+
+		for _, s := range samples {
+			lo = min(lo, s.delay)
+			hi = max(hi, s.delay)
+			sum += s.delay
+		}
+
+		mean := sum / time.Duration(len(samples))
+
+		lines = append(lines, fmt.Sprintf("%s: %.1f / %.1f / %.1f ms", latencyNames[stage], ms(lo), ms(mean), ms(hi)))
+	}
+
+	if len(lines) == 0 {
+		return "Latency: no data yet"
+	}
+
+	return "Latency (min / mean / max)\n" + strings.Join(lines, "\n")
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,156 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+//
+import "C"
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const levelFloor = -120
+
+// ToLevels measures peak and RMS of every channel of the WAVE packet p and
+// stores them in its header.
+func (p *Packet) ToLevels() {
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(p.WaveHeader.Speakers)))
+	if channels == 0 || channels > C.MAX_AUDIO_CHANNELS || p.WaveHeader.Frames == 0 {
+		return
+	}
+
+	samples := pcmToFloat(p.Buffer[len(p.Buffer)-int(p.Header.Size):], p.WaveHeader.Format)
+
+	var sum [C.MAX_AUDIO_CHANNELS]float64
+
+	p.WaveHeader.Peak = [C.MAX_AUDIO_CHANNELS]float32{}
+	p.WaveHeader.RMS = [C.MAX_AUDIO_CHANNELS]float32{}
+
+	for i, v := range samples {
+		c := i % channels
+
+		p.WaveHeader.Peak[c] = max(p.WaveHeader.Peak[c], v, -v)
+		sum[c] += float64(v) * float64(v)
+	}
+
+	frames := len(samples) / channels
+
+	for c := 0; c < channels; c++ {
+		p.WaveHeader.RMS[c] = float32(math.Sqrt(sum[c] / float64(frames)))
+	}
+
+	h := bytes.Buffer{}
+
+	binary.Write(&h, binary.LittleEndian, &p.Header)
+	binary.Write(&h, binary.LittleEndian, &p.WaveHeader)
+
+	copy(p.Buffer, h.Bytes())
+}
+
+func levelToDB(v float32) float64 {
+	return math.Round(max(20*math.Log10(float64(v)), levelFloor)*10) / 10
+}
+
+// TrackLevels holds the levels of one audio track in dBFS.
+type TrackLevels struct {
+	Track int
+	Peak  []float64
+	RMS   []float64
+}
+
+// AudioLevels keeps the most recent levels per track as received, before
+// any muting or monitoring on the receiving side.
+type AudioLevels struct {
+	sync.Mutex
+	tracks map[int]TrackLevels
+}
+
+// AudioLevelsUpdate records the levels of the audio packet p.
+func (l *AudioLevels) AudioLevelsUpdate(p *Packet) TrackLevels {
+	channels := min(int(C.get_audio_channels(C.enum_speaker_layout(p.WaveHeader.Speakers))), C.MAX_AUDIO_CHANNELS)
+
+	t := TrackLevels{
+		Track: int(p.WaveHeader.Track),
+		Peak:  make([]float64, channels),
+		RMS:   make([]float64, channels),
+	}
+
+	for c := 0; c < channels; c++ {
+		t.Peak[c] = levelToDB(p.WaveHeader.Peak[c])
+		t.RMS[c] = levelToDB(p.WaveHeader.RMS[c])
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.tracks == nil {
+		l.tracks = make(map[int]TrackLevels)
+	}
+	l.tracks[t.Track] = t
+
+	return t
+}
+
+// AudioLevelsReset forgets all levels, e.g. after a disconnect.
+func (l *AudioLevels) AudioLevelsReset() {
+	l.Lock()
+	defer l.Unlock()
+
+	l.tracks = nil
+}
+
+// AudioLevelsInfo returns the levels in a human readable form.
+func (l *AudioLevels) AudioLevelsInfo() string {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.tracks) == 0 {
+		return "Audio Levels: no signal"
+	}
+
+	var keys []int
+	for k := range l.tracks {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var lines []string
+
+	for _, k := range keys {
+		t := l.tracks[k]
+
+		var channels []string
+		for c := range t.Peak {
+			channels = append(channels, fmt.Sprintf("%.1f / %.1f", t.Peak[c], t.RMS[c]))
+		}
+
+		lines = append(lines, fmt.Sprintf("Track %d (peak / RMS dB): %s", t.Track+1, strings.Join(channels, ", ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
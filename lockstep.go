@@ -0,0 +1,139 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+//
+import "C"
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	lockstepSyncWait = 10 * time.Millisecond
+	lockstepLate     = 5 * time.Millisecond
+	lockstepWarn     = 10 * time.Second
+)
+
+// Lockstep presents packets at their sender timestamp, mapped onto the
+// local clock, plus a fixed latency. Receivers of the same sender share
+// its clock that way, so with the same latency they all show a frame at
+// the same moment.
+type Lockstep struct {
+	sync.Mutex
+	latency  time.Duration
+	packets  []*Packet
+	late     time.Duration
+	lastWarn uint64
+	signal   chan any
+}
+
+// LockstepReset empties the buffer and sets a new latency. A latency of 0
+// disables lockstep presentation.
+func (l *Lockstep) LockstepReset(latency time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.latency = latency
+	l.packets = nil
+	l.late = 0
+
+	if l.signal == nil {
+		l.signal = make(chan any, 1)
+	}
+}
+
+func (l *Lockstep) LockstepEnabled() bool {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.latency > 0
+}
+
+// LockstepPush adds the decoded packet p.
+func (l *Lockstep) LockstepPush(p *Packet) {
+	l.Lock()
+	defer l.Unlock()
+
+	i := sort.Search(len(l.packets), func(i int) bool {
+		return l.packets[i].Sent > p.Sent
+	})
+	l.packets = append(l.packets, nil)
+	copy(l.packets[i+1:], l.packets[i:])
+	l.packets[i] = p
+
+	select {
+	case l.signal <- nil:
+	default:
+	}
+}
+
+// LockstepPop returns the next packet that is due at local time now.
+// Otherwise it returns how long to wait for it. Nothing is due before the
+// clock is synchronised.
+func (l *Lockstep) LockstepPop(now uint64, clock *ClockSync) (*Packet, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.packets) == 0 {
+		return nil, time.Second
+	}
+
+	p := l.packets[0]
+
+	local, ok := clock.ClockSyncToLocal(p.Sent)
+	if !ok {
+		return nil, lockstepSyncWait
+	}
+
+	due := local + uint64(l.latency)
+	if int64(due-now) > 0 {
+		return nil, time.Duration(due - now)
+	}
+
+	// late packets are presented right away, but the latency is too low
+	if late := time.Duration(now - due); late > lockstepLate {
+		l.late = max(l.late, late)
+
+		if time.Duration(now-l.lastWarn) > lockstepWarn {
+			l.lastWarn = now
+			blog(C.LOG_WARNING, fmt.Sprintf("lockstep: packets up to %.1f ms late, consider a higher latency", ms(l.late)))
+			l.late = 0
+		}
+	}
+
+	l.packets[0] = nil
+	l.packets = l.packets[1:]
+
+	return p, 0
+}
+
+// LockstepSignal fires whenever a packet was added.
+func (l *Lockstep) LockstepSignal() chan any {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.signal
+}
@@ -0,0 +1,118 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+//
+import "C"
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// TrackMixer sums up the audio of several tracks. Packets of all tracks
+// share the same timestamps, so they are collected by timestamp until
+// every track has delivered its part.
+type TrackMixer struct {
+	pending map[uint64][]*Packet
+}
+
+func waveToFloat(p *Packet) []float32 {
+	return pcmToFloat(p.Buffer, p.WaveHeader.Format)
+}
+
+func mixPackets(packets []*Packet) *Packet {
+	p := packets[0]
+
+	var mix []float32
+
+	for _, t := range packets {
+		if t.WaveHeader.SampleRate != p.WaveHeader.SampleRate || t.WaveHeader.Speakers != p.WaveHeader.Speakers || t.WaveHeader.Frames != p.WaveHeader.Frames {
+			continue
+		}
+
+		samples := waveToFloat(t)
+
+		if mix == nil {
+			mix = samples
+			continue
+		}
+
+		for i := range min(len(mix), len(samples)) {
+			mix[i] += samples[i]
+		}
+	}
+
+	if mix == nil {
+		return p
+	}
+
+	p.Buffer = make([]byte, len(mix)*4)
+
+	for i, v := range mix {
+		binary.LittleEndian.PutUint32(p.Buffer[i*4:], math.Float32bits(v))
+	}
+
+	p.Header.Size = int32(len(p.Buffer))
+	p.WaveHeader.Format = C.AUDIO_FORMAT_FLOAT
+
+	return p
+}
+
+// TrackMixerAdd adds the audio packet p to the mix of tracks. It returns
+// all mixed packets that are complete. Mixes that don't complete in time
+// are flushed with whatever tracks are available.
+func (m *TrackMixer) TrackMixerAdd(p *Packet, tracks int) []*Packet {
+	if tracks <= 1 {
+		return []*Packet{p}
+	}
+
+	if m.pending == nil {
+		m.pending = make(map[uint64][]*Packet)
+	}
+
+	m.pending[p.Header.Timestamp] = append(m.pending[p.Header.Timestamp], p)
+
+	var timestamps []uint64
+	for ts := range m.pending {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+
+	var mixed []*Packet
+
+	for _, ts := range timestamps {
+		// keep the order, later mixes wait for earlier ones
+		if len(m.pending[ts]) < tracks && time.Duration(int64(p.Header.Timestamp-ts)) < 500*time.Millisecond {
+			break
+		}
+
+		mixed = append(mixed, mixPackets(m.pending[ts]))
+		delete(m.pending, ts)
+	}
+
+	return mixed
+}
@@ -0,0 +1,252 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #cgo LDFLAGS: -lopus
+//
+// #include <obs-module.h>
+// #include <opus/opus.h>
+//
+// extern int set_opus_bitrate(OpusEncoder *st, int bitrate);
+//
+import "C"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+const (
+	audioCodecPCM = iota
+	audioCodecOpus
+	audioCodecLossless
+)
+
+type OpusEncoder struct {
+	sync.Mutex
+	enc        *C.OpusEncoder
+	sampleRate int
+	channels   int
+	bitrate    int
+	frameSize  int
+	pending    []float32
+	timestamp  uint64
+	warned     bool
+}
+
+type OpusDecoder struct {
+	dec        *C.OpusDecoder
+	sampleRate int
+	channels   int
+}
+
+func opusSupported(sampleRate int, channels int) bool {
+	switch sampleRate {
+	case 8000, 12000, 16000, 24000, 48000:
+	default:
+		return false
+	}
+
+	return channels == 1 || channels == 2
+}
+
+// OpusEncode feeds the audio of the WAVE packet p into the encoder and
+// returns all OPUS packets that could be completed. ok is false if the
+// audio format is not supported by Opus and p should be sent as is.
+func (o *OpusEncoder) OpusEncode(p *Packet, bitrate int, frameDuration time.Duration) (packets [][]byte, ok bool) {
+	o.Lock()
+	defer o.Unlock()
+
+	sampleRate := int(p.WaveHeader.SampleRate)
+	channels := int(p.WaveHeader.Speakers)
+	frameSize := int(time.Duration(sampleRate) * frameDuration / time.Second)
+
+	format := C.enum_audio_format(p.WaveHeader.Format)
+
+	if !opusSupported(sampleRate, channels) || (format != C.AUDIO_FORMAT_FLOAT && format != C.AUDIO_FORMAT_16BIT) {
+		if !o.warned {
+			blog(C.LOG_WARNING, "opus: unsupported audio format, sending uncompressed ("+strconv.Itoa(sampleRate)+" Hz, "+strconv.Itoa(channels)+" channels)")
+			o.warned = true
+		}
+		return nil, false
+	}
+
+	if o.enc == nil || o.sampleRate != sampleRate || o.channels != channels || o.frameSize != frameSize {
+		o.opusEncoderDestroy()
+
+		var err C.int
+
+		o.enc = C.opus_encoder_create(C.opus_int32(sampleRate), C.int(channels), C.OPUS_APPLICATION_AUDIO, &err)
+		if err != C.OPUS_OK {
+			blog(C.LOG_ERROR, "opus: "+C.GoString(C.opus_strerror(err)))
+			o.enc = nil
+			return nil, false
+		}
+
+		o.sampleRate = sampleRate
+		o.channels = channels
+		o.frameSize = frameSize
+		o.bitrate = 0
+		o.pending = nil
+	}
+
+	if o.bitrate != bitrate {
+		C.set_opus_bitrate(o.enc, C.int(bitrate*1000))
+		o.bitrate = bitrate
+	}
+
+	// restart on gaps, otherwise timestamps of the following packets drift
+	expected := o.timestamp + uint64(time.Duration(len(o.pending)/channels)*time.Second/time.Duration(sampleRate))
+	if len(o.pending) == 0 || time.Duration(math.Abs(float64(int64(p.Header.Timestamp-expected)))) > time.Millisecond {
+		o.pending = o.pending[:0]
+		o.timestamp = p.Header.Timestamp
+	}
+
+	wave := p.Buffer[len(p.Buffer)-int(p.Header.Size):]
+
+	switch format {
+	case C.AUDIO_FORMAT_FLOAT:
+		for i := 0; i < len(wave); i += 4 {
+			o.pending = append(o.pending, math.Float32frombits(binary.LittleEndian.Uint32(wave[i:])))
+		}
+	case C.AUDIO_FORMAT_16BIT:
+		for i := 0; i < len(wave); i += 2 {
+			o.pending = append(o.pending, float32(int16(binary.LittleEndian.Uint16(wave[i:])))/32768)
+		}
+	}
+
+	buf := make([]byte, 4000)
+
+	for len(o.pending) >= frameSize*channels {
+		size := C.opus_encode_float(o.enc, (*C.float)(unsafe.Pointer(&o.pending[0])), C.int(frameSize), (*C.uchar)(unsafe.Pointer(&buf[0])), C.opus_int32(len(buf)))
+		if size < 0 {
+			blog(C.LOG_ERROR, "opus: "+C.GoString(C.opus_strerror(C.int(size))))
+			o.pending = o.pending[:0]
+			break
+		}
+
+		header := Header{
+			Type:      [4]byte{'O', 'P', 'U', 'S'},
+			Timestamp: o.timestamp,
+			Size:      int32(size),
+		}
+
+		waveHeader := WaveHeader{
+			Format:     C.AUDIO_FORMAT_FLOAT,
+			SampleRate: int32(sampleRate),
+			Speakers:   int32(channels),
+			Frames:     int32(frameSize),
+			Track:      p.WaveHeader.Track,
+			Peak:       p.WaveHeader.Peak,
+			RMS:        p.WaveHeader.RMS,
+			Capture:    p.WaveHeader.Capture,
+		}
+
+		h := bytes.Buffer{}
+
+		binary.Write(&h, binary.LittleEndian, &header)
+		binary.Write(&h, binary.LittleEndian, &waveHeader)
+		h.Write(buf[:size])
+
+		packets = append(packets, h.Bytes())
+
+		o.pending = o.pending[frameSize*channels:]
+		o.timestamp += uint64(time.Duration(frameSize) * time.Second / time.Duration(sampleRate))
+	}
+
+	return packets, true
+}
+
+func (o *OpusEncoder) opusEncoderDestroy() {
+	if o.enc != nil {
+		C.opus_encoder_destroy(o.enc)
+		o.enc = nil
+	}
+}
+
+func (o *OpusEncoder) OpusEncoderClose() {
+	o.Lock()
+	defer o.Unlock()
+
+	o.opusEncoderDestroy()
+}
+
+// FromOPUS decodes the Opus payload of p and turns it into a WAVE packet
+// carrying interleaved float samples.
+func (p *Packet) FromOPUS(d *OpusDecoder) error {
+	sampleRate := int(p.WaveHeader.SampleRate)
+	channels := int(p.WaveHeader.Speakers)
+
+	if !opusSupported(sampleRate, channels) {
+		return errors.New("invalid opus format")
+	}
+
+	if len(p.Buffer) == 0 {
+		return errors.New("empty opus packet")
+	}
+
+	if d.dec == nil || d.sampleRate != sampleRate || d.channels != channels {
+		d.OpusDecoderClose()
+
+		var err C.int
+
+		d.dec = C.opus_decoder_create(C.opus_int32(sampleRate), C.int(channels), &err)
+		if err != C.OPUS_OK {
+			d.dec = nil
+			return errors.New(C.GoString(C.opus_strerror(err)))
+		}
+
+		d.sampleRate = sampleRate
+		d.channels = channels
+	}
+
+	// 120 ms is the longest frame Opus can produce
+	maxFrames := sampleRate * 120 / 1000
+
+	buf := make([]byte, maxFrames*channels*4)
+
+	frames := C.opus_decode_float(d.dec, (*C.uchar)(unsafe.Pointer(&p.Buffer[0])), C.opus_int32(len(p.Buffer)), (*C.float)(unsafe.Pointer(&buf[0])), C.int(maxFrames), 0)
+	if frames < 0 {
+		return errors.New(C.GoString(C.opus_strerror(frames)))
+	}
+
+	p.Buffer = buf[:int(frames)*channels*4]
+
+	p.Header.Type = [4]byte{'W', 'A', 'V', 'E'}
+	p.Header.Size = int32(len(p.Buffer))
+	p.WaveHeader.Format = C.AUDIO_FORMAT_FLOAT
+	p.WaveHeader.Frames = int32(frames)
+
+	return nil
+}
+
+func (d *OpusDecoder) OpusDecoderClose() {
+	if d.dec != nil {
+		C.opus_decoder_destroy(d.dec)
+		d.dec = nil
+	}
+}
@@ -22,28 +22,25 @@ package main
 
 //
 // #include <obs-module.h>
+// #include <util/platform.h>
 //
 import "C"
 import (
-	"bytes"
 	"net"
 	"runtime/cgo"
 	"strconv"
 	"sync"
-	"time"
 	"unsafe"
 )
 
 type teleportOutput struct {
-	sync.Mutex
 	sync.WaitGroup
 	Announcer
 	Sender
-	pool         *Pool
-	done         chan any
-	output       *C.obs_output_t
-	queue        []*Packet
-	laggedFrames int
+	VideoEncoder
+	AudioWires
+	done   chan any
+	output *C.obs_output_t
 }
 
 //export output_get_name
@@ -54,8 +51,10 @@ func output_get_name(type_data C.uintptr_t) *C.char {
 //export output_create
 func output_create(settings *C.obs_data_t, output *C.obs_output_t) C.uintptr_t {
 	h := &teleportOutput{
+		VideoEncoder: VideoEncoder{
+			pool: NewPool(10),
+		},
 		output: output,
-		pool:   NewPool(10),
 	}
 
 	return C.uintptr_t(cgo.NewHandle(h))
@@ -63,6 +62,10 @@ func output_create(settings *C.obs_data_t, output *C.obs_output_t) C.uintptr_t {
 
 //export output_destroy
 func output_destroy(data C.uintptr_t) {
+	h := cgo.Handle(data).Value().(*teleportOutput)
+
+	h.AudioWiresClose()
+
 	cgo.Handle(data).Delete()
 }
 
@@ -70,6 +73,15 @@ func output_destroy(data C.uintptr_t) {
 func output_start(data C.uintptr_t) C.bool {
 	h := cgo.Handle(data).Value().(*teleportOutput)
 
+	settings := C.obs_source_get_settings(dummy)
+	mixers := 0
+	for _, track := range track_settings(settings) {
+		mixers |= 1 << track
+	}
+	C.obs_data_release(settings)
+
+	C.obs_output_set_mixers(h.output, C.size_t(mixers))
+
 	if !C.obs_output_can_begin_data_capture(h.output, 0) {
 		return false
 	}
@@ -93,7 +105,8 @@ func output_start(data C.uintptr_t) C.bool {
 	}
 
 	h.done = make(chan any)
-	h.laggedFrames = 0
+	h.EncoderBacklogReset()
+	h.TimecodeGeneratorReset()
 
 	h.Add(1)
 	go h.outputLoop()
@@ -112,6 +125,7 @@ func output_stop(data C.uintptr_t, ts C.uint64_t) {
 
 	h.done <- nil
 	h.Wait()
+	h.VideoEncoderWait()
 
 	close(h.done)
 	h.done = nil
@@ -128,19 +142,16 @@ func output_raw_video(data C.uintptr_t, frame *C.struct_video_data) {
 		return
 	}
 
-	p := &Packet{
-		Header: Header{
-			Timestamp: uint64(frame.timestamp),
-		},
-		ImageBuffer: h.pool.Get().(*bytes.Buffer),
-	}
-
 	settings := C.obs_source_get_settings(dummy)
-	p.Quality = int(C.obs_data_get_int(settings, quality_str))
+	video := video_settings(settings)
 	C.obs_data_release(settings)
 
-	video := C.obs_output_video(h.output)
-	info := C.video_output_get_info(video)
+	p, variants, main := h.VideoEncoderAccept(&h.Sender, uint64(frame.timestamp), video)
+	if p == nil {
+		return
+	}
+
+	info := C.video_output_get_info(C.obs_output_video(h.output))
 
 	format := info.format
 
@@ -154,73 +165,85 @@ func output_raw_video(data C.uintptr_t, frame *C.struct_video_data) {
 
 	p.ToImage(C.obs_output_get_width(h.output), C.obs_output_get_height(h.output), format, frame.data)
 	if p.Image == nil {
+		h.VideoEncoderRelease(p)
 		return
 	}
 
 	C.video_format_get_parameters(info.colorspace, info._range, (*C.float)(unsafe.Pointer(&p.ImageHeader.ColorMatrix[0])), (*C.float)(unsafe.Pointer(&p.ImageHeader.ColorRangeMin[0])), (*C.float)(unsafe.Pointer(&p.ImageHeader.ColorRangeMax[0])))
 
-	h.Lock()
-	h.queue = append(h.queue, p)
+	h.VideoEncoderEncode(&h.Sender, p, video, variants, main)
+}
 
-	queueSize := time.Duration(h.queue[len(h.queue)-1].Header.Timestamp - h.queue[0].Header.Timestamp)
+//export output_raw_audio2
+func output_raw_audio2(data C.uintptr_t, idx C.size_t, frames *C.struct_audio_data) {
+	h := cgo.Handle(data).Value().(*teleportOutput)
 
-	if queueSize > time.Second {
-		blog(C.LOG_WARNING, "encoder queue exceeded: "+queueSize.String())
-		h.laggedFrames++
+	if h.SenderGetNumConns() == 0 {
+		return
 	}
-	h.Unlock()
 
-	h.Add(1)
-	go func(p *Packet) {
-		defer h.Done()
+	audio := C.audio_output_get_info(C.obs_output_audio(h.output))
+	info := AudioInfo{
+		Format:     audio.format,
+		Speakers:   audio.speakers,
+		SampleRate: audio.samples_per_sec,
+	}
 
-		p.ToJPEG(h.pool)
+	p := Packet{
+		Header: Header{
+			Timestamp: uint64(frames.timestamp),
+		},
+		WaveHeader: WaveHeader{
+			Track:   int32(idx),
+			Capture: uint64(C.os_gettime_ns()),
+		},
+	}
 
-		h.Lock()
-		defer h.Unlock()
+	p.ToWAVE(info, frames.frames, frames.data)
 
-		p.DoneProcessing = true
+	settings := C.obs_source_get_settings(dummy)
+	audioSettings := audio_settings(settings)
+	calibration := bool(C.obs_data_get_bool(settings, calibration_str))
+	C.obs_data_release(settings)
 
-		for len(h.queue) > 0 && h.queue[0].DoneProcessing {
-			h.SenderSend(h.queue[0].Buffer)
-			h.pool.Put(h.queue[0].ImageBuffer)
+	if calibration {
+		p.ToCalibrationTone()
+	}
 
-			h.queue[0] = nil
-			h.queue = h.queue[1:]
-		}
-	}(p)
+	h.AudioWiresSend(&h.Sender, &p, audioSettings)
 }
 
-//export output_raw_audio
-func output_raw_audio(data C.uintptr_t, frames *C.struct_audio_data) {
-	h := cgo.Handle(data).Value().(*teleportOutput)
+func outputRateControlInfo() string {
+	if output == nil {
+		return ""
+	}
 
-	if h.SenderGetNumConns() == 0 {
-		return
+	data := C.obs_obj_get_data(unsafe.Pointer(output))
+	if data == nil {
+		return ""
 	}
 
-	audio := C.obs_output_audio(h.output)
-	info := C.audio_output_get_info(audio)
+	return cgo.Handle(uintptr(data)).Value().(*teleportOutput).RateControlInfo()
+}
 
-	p := Packet{
-		Header: Header{
-			Timestamp: uint64(frames.timestamp),
-		},
+func outputDroppedFrames() int {
+	if output == nil {
+		return 0
 	}
 
-	p.ToWAVE(info, frames.frames, frames.data)
+	data := C.obs_obj_get_data(unsafe.Pointer(output))
+	if data == nil {
+		return 0
+	}
 
-	h.SenderSend(p.Buffer)
+	return cgo.Handle(uintptr(data)).Value().(*teleportOutput).EncoderBacklogDropped()
 }
 
 //export output_get_dropped_frames
 func output_get_dropped_frames(data C.uintptr_t) C.int {
 	h := cgo.Handle(data).Value().(*teleportOutput)
 
-	h.Lock()
-	defer h.Unlock()
-
-	return C.int(h.laggedFrames)
+	return C.int(h.EncoderBacklogDropped())
 }
 
 func (h *teleportOutput) outputLoop() {
@@ -230,8 +253,12 @@ func (h *teleportOutput) outputLoop() {
 	settings := C.obs_source_get_settings(dummy)
 	name := C.GoString(C.obs_data_get_string(settings, identifier_str))
 	listenPort := int(C.obs_data_get_int(settings, port_str))
+	variants := variant_settings(settings)
+	tracks := track_settings(settings)
 	C.obs_data_release(settings)
 
+	h.SenderSetVariants(variants)
+
 	l, err := net.Listen("tcp", ":"+strconv.Itoa(listenPort))
 	if err != nil {
 		blog(C.LOG_ERROR, "unable binding to port: "+strconv.Itoa(listenPort))
@@ -265,7 +292,7 @@ func (h *teleportOutput) outputLoop() {
 
 	port, _ := strconv.Atoi(p)
 
-	h.StartAnnouncer(name, port, true)
+	h.StartAnnouncer(name, port, true, variants, tracks)
 	defer h.StopAnnouncer()
 
 	<-h.done
@@ -33,6 +33,7 @@ import (
 	"errors"
 	"image"
 	"runtime"
+	"time"
 	"unsafe"
 )
 
@@ -43,7 +44,15 @@ type Packet struct {
 	Buffer         []byte
 	IsAudio        bool
 	DoneProcessing bool
+	Dropped        bool
 	Quality        int
+	Bitrate        int
+	Variant        string
+	Variants       []*Packet
+	Arrival        uint64
+	Delayed        time.Duration
+	Sent           uint64
+	Decoded        uint64
 	Image          image.Image
 	ImageBuffer    *bytes.Buffer
 }
@@ -445,46 +454,45 @@ func (p *Packet) ToImage(w C.uint32_t, h C.uint32_t, format C.enum_video_format,
 	return
 }
 
-func (p *Packet) ToWAVE(info *C.struct_audio_output_info, frames C.uint32_t, data [C.MAX_AUDIO_CHANNELS]*C.uint8_t) {
-	var (
-		bytesPerSample int
-		format         C.enum_video_format
-	)
+// AudioInfo describes the layout of raw OBS audio data.
+type AudioInfo struct {
+	Format     C.enum_audio_format
+	Speakers   C.enum_speaker_layout
+	SampleRate C.uint32_t
+}
 
-	switch info.format {
-	case C.AUDIO_FORMAT_U8BIT:
-		fallthrough
-	case C.AUDIO_FORMAT_U8BIT_PLANAR:
-		bytesPerSample = 1
+// ToWAVE converts raw OBS audio described by info into the interleaved
+// wire format of a WAVE packet.
+func (p *Packet) ToWAVE(info AudioInfo, frames C.uint32_t, data [C.MAX_AUDIO_CHANNELS]*C.uint8_t) {
+	var format C.enum_audio_format
+
+	switch info.Format {
+	case C.AUDIO_FORMAT_U8BIT, C.AUDIO_FORMAT_U8BIT_PLANAR:
 		format = C.AUDIO_FORMAT_U8BIT
-	case C.AUDIO_FORMAT_16BIT:
-		fallthrough
-	case C.AUDIO_FORMAT_16BIT_PLANAR:
-		bytesPerSample = 2
+	case C.AUDIO_FORMAT_16BIT, C.AUDIO_FORMAT_16BIT_PLANAR:
 		format = C.AUDIO_FORMAT_16BIT
-	case C.AUDIO_FORMAT_32BIT:
-		fallthrough
-	case C.AUDIO_FORMAT_32BIT_PLANAR:
-		bytesPerSample = 4
+	case C.AUDIO_FORMAT_32BIT, C.AUDIO_FORMAT_32BIT_PLANAR:
 		format = C.AUDIO_FORMAT_32BIT
-	case C.AUDIO_FORMAT_FLOAT:
-		fallthrough
-	case C.AUDIO_FORMAT_FLOAT_PLANAR:
-		bytesPerSample = 4
+	case C.AUDIO_FORMAT_FLOAT, C.AUDIO_FORMAT_FLOAT_PLANAR:
 		format = C.AUDIO_FORMAT_FLOAT
 	}
 
+	bytesPerSample := int(C.get_audio_bytes_per_channel(info.Format))
+	channels := int(C.get_audio_channels(info.Speakers))
+
 	p.Header = Header{
 		Type:      [4]byte{'W', 'A', 'V', 'E'},
 		Timestamp: p.Header.Timestamp,
-		Size:      int32(bytesPerSample * int(info.speakers) * int(frames)),
+		Size:      int32(bytesPerSample * channels * int(frames)),
 	}
 
 	p.WaveHeader = WaveHeader{
 		Format:     int32(format),
-		SampleRate: int32(info.samples_per_sec),
-		Speakers:   int32(info.speakers),
+		SampleRate: int32(info.SampleRate),
+		Speakers:   int32(info.Speakers),
 		Frames:     int32(frames),
+		Track:      p.WaveHeader.Track,
+		Capture:    p.WaveHeader.Capture,
 	}
 
 	h := bytes.Buffer{}
@@ -498,50 +506,113 @@ func (p *Packet) ToWAVE(info *C.struct_audio_output_info, frames C.uint32_t, dat
 
 	wave := p.Buffer[len(p.Buffer)-int(p.Header.Size):]
 
-	switch info.format {
-	case C.AUDIO_FORMAT_32BIT_PLANAR:
-		fallthrough
-	case C.AUDIO_FORMAT_FLOAT_PLANAR:
-		var tmp [C.MAX_AUDIO_CHANNELS][]byte
+	if len(wave) == 0 {
+		return
+	}
 
-		for i := 0; i < int(info.speakers); i++ {
-			tmp[i] = unsafe.Slice((*byte)(data[i]), int(frames)*bytesPerSample)
-		}
+	if !C.is_audio_planar(info.Format) {
+		copy(wave, unsafe.Slice((*byte)(data[0]), len(wave)))
+		return
+	}
 
-		for i := 0; i < int(frames); i++ {
-			for j := 0; j < int(info.speakers); j++ {
-				wave[i*int(info.speakers)*4+j*4+0] = tmp[j][i*4+0]
-				wave[i*int(info.speakers)*4+j*4+1] = tmp[j][i*4+1]
-				wave[i*int(info.speakers)*4+j*4+2] = tmp[j][i*4+2]
-				wave[i*int(info.speakers)*4+j*4+3] = tmp[j][i*4+3]
-			}
+	for j := 0; j < channels; j++ {
+		if data[j] == nil {
+			continue
 		}
-	case C.AUDIO_FORMAT_16BIT_PLANAR:
-		var tmp [C.MAX_AUDIO_CHANNELS][]byte
 
-		for i := 0; i < int(info.speakers); i++ {
-			tmp[i] = unsafe.Slice((*byte)(data[i]), int(frames)*bytesPerSample)
-		}
+		plane := unsafe.Slice((*byte)(data[j]), int(frames)*bytesPerSample)
 
 		for i := 0; i < int(frames); i++ {
-			for j := 0; j < int(info.speakers); j++ {
-				wave[i*int(info.speakers)*2+j*2+0] = tmp[j][i*2+0]
-				wave[i*int(info.speakers)*2+j*2+1] = tmp[j][i*2+1]
-			}
+			copy(wave[(i*channels+j)*bytesPerSample:(i*channels+j+1)*bytesPerSample], plane[i*bytesPerSample:])
 		}
-	case C.AUDIO_FORMAT_U8BIT_PLANAR:
-		var tmp [C.MAX_AUDIO_CHANNELS][]byte
+	}
+}
 
-		for i := 0; i < int(info.speakers); i++ {
-			tmp[i] = unsafe.Slice((*byte)(data[i]), int(frames)*bytesPerSample)
-		}
+// CheckWAVE verifies that the audio data matches its WAVE header.
+func (p *Packet) CheckWAVE() error {
+	sampleSize, _ := waveSampleSize(p.WaveHeader.Format)
+	if sampleSize == 0 {
+		return errors.New("unknown sample format")
+	}
 
-		for i := 0; i < int(frames); i++ {
-			for j := 0; j < int(info.speakers); j++ {
-				wave[i*int(info.speakers)+j] = tmp[j][i]
-			}
-		}
-	default:
-		copy(wave, unsafe.Slice((*byte)(data[0]), len(wave)))
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(p.WaveHeader.Speakers)))
+	if channels == 0 {
+		return errors.New("unknown speaker layout")
+	}
+
+	if p.WaveHeader.Frames <= 0 || p.WaveHeader.SampleRate <= 0 || len(p.Buffer) != int(p.WaveHeader.Frames)*channels*sampleSize {
+		return errors.New("invalid audio size")
 	}
+
+	return nil
+}
+
+func waveSampleSize(format int32) (int, bool) {
+	if format == waveFormat24Bit {
+		return 3, false
+	}
+
+	switch C.enum_audio_format(format) {
+	case C.AUDIO_FORMAT_U8BIT:
+		return 1, false
+	case C.AUDIO_FORMAT_16BIT:
+		return 2, false
+	case C.AUDIO_FORMAT_32BIT:
+		return 4, false
+	case C.AUDIO_FORMAT_FLOAT:
+		return 4, true
+	}
+
+	return 0, false
+}
+
+// ToRICE returns the WAVE packet p losslessly compressed as a RICE packet.
+// If compression does not pay off the WAVE packet is returned unchanged.
+func (p *Packet) ToRICE() []byte {
+	sampleSize, float := waveSampleSize(p.WaveHeader.Format)
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(p.WaveHeader.Speakers)))
+	if sampleSize == 0 || channels == 0 {
+		return p.Buffer
+	}
+
+	wave := p.Buffer[len(p.Buffer)-int(p.Header.Size):]
+
+	data := riceEncode(wave, channels, sampleSize, float)
+	if len(data) >= len(wave) {
+		return p.Buffer
+	}
+
+	header := p.Header
+	header.Type = [4]byte{'R', 'I', 'C', 'E'}
+	header.Size = int32(len(data))
+
+	h := bytes.Buffer{}
+
+	binary.Write(&h, binary.LittleEndian, &header)
+	binary.Write(&h, binary.LittleEndian, &p.WaveHeader)
+
+	return append(h.Bytes(), data...)
+}
+
+// FromRICE restores the PCM of a RICE packet and turns it into a WAVE packet.
+func (p *Packet) FromRICE() error {
+	sampleSize, float := waveSampleSize(p.WaveHeader.Format)
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(p.WaveHeader.Speakers)))
+
+	// a single packet never covers more than a second of audio
+	if sampleSize == 0 || channels == 0 || p.WaveHeader.Frames < 0 || p.WaveHeader.Frames > max(p.WaveHeader.SampleRate, 0) {
+		return errors.New("invalid lossless audio format")
+	}
+
+	wave, err := riceDecode(p.Buffer, int(p.WaveHeader.Frames), channels, sampleSize, float)
+	if err != nil {
+		return err
+	}
+
+	p.Buffer = wave
+
+	p.Header.Type = [4]byte{'W', 'A', 'V', 'E'}
+	p.Header.Size = int32(len(p.Buffer))
+
+	return nil
 }
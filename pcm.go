@@ -0,0 +1,264 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+//
+import "C"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand/v2"
+)
+
+// waveFormat24Bit describes packed 24 bit samples. It is not an OBS audio
+// format and only used on the wire, receivers widen it to 32 bit.
+const waveFormat24Bit = 0x100
+
+const (
+	bitDepthOriginal = 0
+	bitDepth16       = 16
+	bitDepth24       = 24
+)
+
+const (
+	sendChannelsAll = iota
+	sendChannelsStereo
+	sendChannelsMono
+	sendChannelsLeft
+	sendChannelsRight
+)
+
+func pcmToFloat(b []byte, format int32) []float32 {
+	sampleSize, float := waveSampleSize(format)
+	if sampleSize == 0 {
+		return nil
+	}
+
+	samples := make([]float32, len(b)/sampleSize)
+
+	for i := range samples {
+		s := b[i*sampleSize:]
+
+		switch {
+		case float:
+			samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(s))
+		case sampleSize == 1:
+			samples[i] = (float32(s[0]) - 128) / 128
+		case sampleSize == 2:
+			samples[i] = float32(int16(binary.LittleEndian.Uint16(s))) / 32768
+		case sampleSize == 3:
+			samples[i] = float32(int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24)>>8) / 8388608
+		default:
+			samples[i] = float32(int32(binary.LittleEndian.Uint32(s))) / 2147483648
+		}
+	}
+
+	return samples
+}
+
+func applyMatrix(samples []float32, channels int, matrix [][]float32) []float32 {
+	frames := len(samples) / channels
+	mixed := make([]float32, frames*len(matrix))
+
+	for i := 0; i < frames; i++ {
+		for o, row := range matrix {
+			sum := float32(0)
+			for c, g := range row {
+				sum += g * samples[i*channels+c]
+			}
+			mixed[i*len(matrix)+o] = sum
+		}
+	}
+
+	return mixed
+}
+
+// quantize converts float samples to signed integers of the given bit depth
+// with triangular dither, so the truncation error becomes plain noise
+// instead of distortion that correlates with the signal.
+func quantize(samples []float32, depth int) []byte {
+	sampleSize := depth / 8
+	scale := float64(int64(1) << (depth - 1))
+
+	b := make([]byte, len(samples)*sampleSize)
+
+	for i, v := range samples {
+		d := rand.Float64() - rand.Float64()
+		s := int32(min(max(math.Round(float64(v)*scale+d), -scale), scale-1))
+
+		switch sampleSize {
+		case 2:
+			binary.LittleEndian.PutUint16(b[i*2:], uint16(s))
+		case 3:
+			b[i*3+0] = byte(s)
+			b[i*3+1] = byte(s >> 8)
+			b[i*3+2] = byte(s >> 16)
+		}
+	}
+
+	return b
+}
+
+// sendChannelMatrix returns the matrix reducing the speaker layout to the
+// channels that should be sent, or nil to send all of them.
+func sendChannelMatrix(mode int, speakers int) [][]float32 {
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(speakers)))
+	if channels == 0 {
+		return nil
+	}
+
+	switch mode {
+	case sendChannelsStereo:
+		return channelMatrix(channelMapStereo, speakers, 0, 0)
+	case sendChannelsMono:
+		return channelMatrix(channelMapMono, speakers, 0, 0)
+	case sendChannelsLeft:
+		return [][]float32{selectChannel(channels, 0)}
+	case sendChannelsRight:
+		return [][]float32{selectChannel(channels, 1)}
+	}
+
+	return nil
+}
+
+// ToReduced converts the WAVE packet p to fewer channels and/or a lower bit
+// depth before sending. Without a matrix and with the original bit depth
+// the packet stays untouched.
+func (p *Packet) ToReduced(matrix [][]float32, depth int) {
+	if matrix == nil && depth == bitDepthOriginal {
+		return
+	}
+
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(p.WaveHeader.Speakers)))
+	if channels == 0 || p.WaveHeader.Frames == 0 {
+		return
+	}
+
+	samples := pcmToFloat(p.Buffer[len(p.Buffer)-int(p.Header.Size):], p.WaveHeader.Format)
+	if samples == nil {
+		return
+	}
+
+	if matrix != nil {
+		samples = applyMatrix(samples, channels, matrix)
+		p.WaveHeader.Speakers = int32(len(matrix))
+	}
+
+	var wave []byte
+
+	switch depth {
+	case bitDepth16:
+		wave = quantize(samples, 16)
+		p.WaveHeader.Format = C.AUDIO_FORMAT_16BIT
+	case bitDepth24:
+		wave = quantize(samples, 24)
+		p.WaveHeader.Format = waveFormat24Bit
+	default:
+		wave = make([]byte, len(samples)*4)
+		for i, v := range samples {
+			binary.LittleEndian.PutUint32(wave[i*4:], math.Float32bits(v))
+		}
+		p.WaveHeader.Format = C.AUDIO_FORMAT_FLOAT
+	}
+
+	p.Header.Size = int32(len(wave))
+
+	h := bytes.Buffer{}
+
+	binary.Write(&h, binary.LittleEndian, &p.Header)
+	binary.Write(&h, binary.LittleEndian, &p.WaveHeader)
+
+	p.Buffer = append(h.Bytes(), wave...)
+}
+
+// From24Bit widens received 24 bit samples to 32 bit, which OBS can handle.
+func (p *Packet) From24Bit() {
+	if p.WaveHeader.Format != waveFormat24Bit {
+		return
+	}
+
+	wave := make([]byte, len(p.Buffer)/3*4)
+
+	for i := 0; i < len(p.Buffer)/3; i++ {
+		wave[i*4+1] = p.Buffer[i*3+0]
+		wave[i*4+2] = p.Buffer[i*3+1]
+		wave[i*4+3] = p.Buffer[i*3+2]
+	}
+
+	p.Buffer = wave
+
+	p.Header.Size = int32(len(p.Buffer))
+	p.WaveHeader.Format = C.AUDIO_FORMAT_32BIT
+}
+
+// WavePeak returns the peak level of the WAVE packet p in dBFS.
+func (p *Packet) WavePeak() float64 {
+	peak := float32(0)
+
+	for _, v := range pcmToFloat(p.Buffer[len(p.Buffer)-int(p.Header.Size):], p.WaveHeader.Format) {
+		peak = max(peak, v, -v)
+	}
+
+	return 20 * math.Log10(float64(peak))
+}
+
+// ToSilence returns a SLNC packet that only describes the format and
+// length of the WAVE packet p, to be expanded into silence by receivers.
+func (p *Packet) ToSilence() []byte {
+	header := p.Header
+	header.Type = [4]byte{'S', 'L', 'N', 'C'}
+	header.Size = 0
+
+	h := bytes.Buffer{}
+
+	binary.Write(&h, binary.LittleEndian, &header)
+	binary.Write(&h, binary.LittleEndian, &p.WaveHeader)
+
+	return h.Bytes()
+}
+
+// FromSilence turns a SLNC packet into a WAVE packet full of silence.
+func (p *Packet) FromSilence() error {
+	sampleSize, _ := waveSampleSize(p.WaveHeader.Format)
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(p.WaveHeader.Speakers)))
+
+	// a single packet never covers more than a second of audio
+	if sampleSize == 0 || channels == 0 || p.WaveHeader.Frames <= 0 || p.WaveHeader.Frames > max(p.WaveHeader.SampleRate, 0) {
+		return errors.New("invalid silence")
+	}
+
+	p.Buffer = make([]byte, int(p.WaveHeader.Frames)*channels*sampleSize)
+
+	if sampleSize == 1 {
+		for i := range p.Buffer {
+			p.Buffer[i] = 128
+		}
+	}
+
+	p.Header.Type = [4]byte{'W', 'A', 'V', 'E'}
+	p.Header.Size = int32(len(p.Buffer))
+
+	return nil
+}
@@ -0,0 +1,145 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+//
+import "C"
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	rateControlQuality = iota
+	rateControlBitrate
+)
+
+// The bitrate is measured over a second, so the quality has to move slowly
+// enough for the measurement to follow. Both are per second, regardless of
+// the frame rate.
+const (
+	rateControlGain = 8  // quality per octave off target
+	rateControlSlew = 20 // maximum quality change
+)
+
+type rateSample struct {
+	timestamp uint64
+	size      int
+}
+
+type RateControl struct {
+	sync.Mutex
+	quality  float64
+	samples  []rateSample
+	achieved float64
+	target   int
+	lastLog  uint64
+}
+
+// RateControlQuality returns the JPEG quality to use for the next frame.
+func (r *RateControl) RateControlQuality() int {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.quality == 0 {
+		r.quality = 90
+	}
+
+	return int(math.Round(r.quality))
+}
+
+// RateControlUpdate feeds the size of an encoded frame back into the
+// controller and nudges the quality towards the target bitrate (Mbps).
+func (r *RateControl) RateControlUpdate(p *Packet) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.quality == 0 {
+		r.quality = 90
+	}
+
+	// timestamps are unsigned, compare signed so a jump back does not wrap
+	if len(r.samples) > 0 {
+		delta := time.Duration(int64(p.Header.Timestamp - r.samples[len(r.samples)-1].timestamp))
+		if delta <= 0 || delta > time.Second {
+			r.samples = nil
+		}
+	}
+
+	r.samples = append(r.samples, rateSample{
+		timestamp: p.Header.Timestamp,
+		size:      len(p.Buffer),
+	})
+	r.target = p.Bitrate
+
+	for len(r.samples) > 2 && time.Duration(int64(p.Header.Timestamp-r.samples[0].timestamp)) > time.Second {
+		r.samples = r.samples[1:]
+	}
+
+	if len(r.samples) < 2 {
+		return
+	}
+
+	span := float64(r.samples[len(r.samples)-1].timestamp - r.samples[0].timestamp)
+	if span <= 0 {
+		return
+	}
+
+	// account for the duration of the last frame as well
+	span *= float64(len(r.samples)) / float64(len(r.samples)-1)
+
+	size := 0
+	for _, s := range r.samples {
+		size += s.size
+	}
+
+	r.achieved = float64(size) * 8 / (span / float64(time.Second))
+
+	frame := span / float64(len(r.samples)) / float64(time.Second)
+
+	step := rateControlGain * math.Log2(float64(r.target)*1000000/r.achieved) * frame
+	r.quality = min(max(r.quality+min(max(step, -rateControlSlew*frame), rateControlSlew*frame), 1), 100)
+
+	if time.Duration(int64(p.Header.Timestamp-r.lastLog)) > 10*time.Second || p.Header.Timestamp < r.lastLog {
+		r.lastLog = p.Header.Timestamp
+		blog(C.LOG_INFO, r.rateControlString())
+	}
+}
+
+// RateControlInfo returns a human readable status of achieved vs. target bitrate.
+func (r *RateControl) RateControlInfo() string {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.rateControlString()
+}
+
+func (r *RateControl) rateControlString() string {
+	if r.target == 0 {
+		return "Bitrate: no data yet"
+	}
+
+	return fmt.Sprintf("Bitrate: %.1f Mbps of %d Mbps target (quality %d)", r.achieved/1000000, r.target, int(math.Round(r.quality)))
+}
@@ -0,0 +1,65 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// rateControlFrameSize models an encoder whose frame size doubles every
+// steps quality points.
+func rateControlFrameSize(quality int, steps float64) int {
+	return int(4000 * math.Pow(2, float64(quality)/steps))
+}
+
+func TestRateControlSettles(t *testing.T) {
+	for _, fps := range []int{30, 60, 120} {
+		for _, steps := range []float64{8, 15} {
+			r := RateControl{}
+
+			minRate, maxRate := math.Inf(1), 0.0
+
+			for i := 0; i < 60*fps; i++ {
+				p := Packet{
+					Header: Header{
+						Timestamp: uint64(i) * uint64(time.Second) / uint64(fps),
+					},
+					Buffer:  make([]byte, rateControlFrameSize(r.RateControlQuality(), steps)),
+					Bitrate: 80,
+				}
+
+				r.RateControlUpdate(&p)
+
+				// judge the last 10 seconds only
+				if i >= 50*fps {
+					minRate = min(minRate, r.achieved)
+					maxRate = max(maxRate, r.achieved)
+				}
+			}
+
+			if minRate < 70e6 || maxRate > 90e6 {
+				t.Errorf("%d fps, %v steps: bitrate %.1f to %.1f Mbps", fps, steps, minRate/1e6, maxRate/1e6)
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+//
+import "C"
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	channelMapNone = iota
+	channelMapStereo
+	channelMapMono
+	channelMapSwap
+	channelMapLeft
+	channelMapRight
+	channelMapCustom
+)
+
+const (
+	resampleOff = 0
+	resampleOBS = -1
+)
+
+// stereoGains returns how much each channel of the speaker layout
+// contributes to the left output channel. OBS orders channels as
+// FL FR FC LFE RL RR SL SR, with 4.0 and 4.1 having a single rear center.
+func stereoGains(speakers int) []float32 {
+	const c = math.Sqrt2 / 2
+
+	switch speakers {
+	case C.SPEAKERS_MONO:
+		return []float32{1}
+	case C.SPEAKERS_STEREO:
+		return []float32{1, 0}
+	case C.SPEAKERS_2POINT1:
+		return []float32{1, 0, 0}
+	case C.SPEAKERS_4POINT0:
+		return []float32{1, 0, c, c}
+	case C.SPEAKERS_4POINT1:
+		return []float32{1, 0, c, 0, c}
+	case C.SPEAKERS_5POINT1:
+		return []float32{1, 0, c, 0, c, 0}
+	case C.SPEAKERS_7POINT1:
+		return []float32{1, 0, c, 0, c, 0, c, 0}
+	}
+
+	return nil
+}
+
+// mirrorGains turns left channel gains into right channel gains by
+// swapping every left/right pair while leaving centered channels alone.
+func mirrorGains(speakers int, left []float32) []float32 {
+	right := make([]float32, len(left))
+	copy(right, left)
+
+	pairs := [][2]int{{0, 1}}
+
+	switch speakers {
+	case C.SPEAKERS_5POINT1:
+		pairs = append(pairs, [2]int{4, 5})
+	case C.SPEAKERS_7POINT1:
+		pairs = append(pairs, [2]int{4, 5}, [2]int{6, 7})
+	}
+
+	for _, pair := range pairs {
+		if pair[1] < len(right) {
+			right[pair[0]], right[pair[1]] = left[pair[1]], left[pair[0]]
+		}
+	}
+
+	return right
+}
+
+func normalizeGains(gains []float32) []float32 {
+	sum := float32(0)
+	for _, g := range gains {
+		sum += g
+	}
+
+	if sum > 1 {
+		for i := range gains {
+			gains[i] /= sum
+		}
+	}
+
+	return gains
+}
+
+func selectChannel(channels int, channel int) []float32 {
+	row := make([]float32, channels)
+	row[min(max(channel, 0), channels-1)] = 1
+
+	return row
+}
+
+// channelMatrix returns the mixing matrix for the given channel map with
+// one row per output channel. It returns nil if the audio passes through
+// unchanged.
+func channelMatrix(mode int, speakers int, left int, right int) [][]float32 {
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(speakers)))
+	if channels == 0 {
+		return nil
+	}
+
+	switch mode {
+	case channelMapStereo:
+		if speakers == C.SPEAKERS_STEREO {
+			return nil
+		}
+
+		l := stereoGains(speakers)
+		if l == nil {
+			return nil
+		}
+		r := mirrorGains(speakers, l)
+
+		return [][]float32{normalizeGains(l), normalizeGains(r)}
+	case channelMapMono:
+		if speakers == C.SPEAKERS_MONO {
+			return nil
+		}
+
+		l := stereoGains(speakers)
+		if l == nil {
+			return nil
+		}
+		r := mirrorGains(speakers, l)
+
+		for i := range l {
+			l[i] = (l[i] + r[i]) / 2
+		}
+
+		return [][]float32{normalizeGains(l)}
+	case channelMapSwap:
+		if channels < 2 {
+			return nil
+		}
+
+		matrix := make([][]float32, channels)
+		for i := range matrix {
+			matrix[i] = selectChannel(channels, i)
+		}
+		matrix[0], matrix[1] = matrix[1], matrix[0]
+
+		return matrix
+	case channelMapLeft:
+		return [][]float32{selectChannel(channels, 0), selectChannel(channels, 0)}
+	case channelMapRight:
+		return [][]float32{selectChannel(channels, 1), selectChannel(channels, 1)}
+	case channelMapCustom:
+		return [][]float32{selectChannel(channels, left-1), selectChannel(channels, right-1)}
+	}
+
+	return nil
+}
+
+// Resampler converts the audio of one stream to a fixed sample rate with
+// cubic interpolation. It keeps the last input frames around so packet
+// boundaries don't cause clicks.
+type Resampler struct {
+	channels  int
+	inRate    int
+	outRate   int
+	pos       float64
+	history   []float32
+	timestamp uint64
+}
+
+func (r *Resampler) reset(channels int, inRate int, outRate int, first []float32) {
+	r.channels = channels
+	r.inRate = inRate
+	r.outRate = outRate
+	r.pos = 2
+
+	// start with the first frame repeated, so the output starts right away
+	r.history = make([]float32, 3*channels)
+	for i := 0; i < 3; i++ {
+		copy(r.history[i*channels:], first[:channels])
+	}
+}
+
+func (r *Resampler) resample(samples []float32, channels int, inRate int, outRate int, drift float64, timestamp uint64) []float32 {
+	frames := len(samples) / channels
+
+	if r.channels != channels || r.inRate != inRate || r.outRate != outRate || time.Duration(math.Abs(float64(int64(timestamp-r.timestamp)))) > 10*time.Millisecond {
+		r.reset(channels, inRate, outRate, samples)
+	}
+
+	r.timestamp = timestamp + uint64(time.Duration(frames)*time.Second/time.Duration(inRate))
+
+	buf := append(r.history, samples...)
+	total := len(buf) / channels
+
+	step := float64(inRate) / (float64(outRate) * drift)
+
+	out := make([]float32, 0, (int(float64(frames)/step)+2)*channels)
+
+	for ; int(r.pos)+2 < total; r.pos += step {
+		i := int(r.pos)
+		t := float32(r.pos - float64(i))
+
+		for c := 0; c < channels; c++ {
+			y0 := buf[(i-1)*channels+c]
+			y1 := buf[i*channels+c]
+			y2 := buf[(i+1)*channels+c]
+			y3 := buf[(i+2)*channels+c]
+
+			// Catmull-Rom spline through y1 and y2
+			a := -0.5*y0 + 1.5*y1 - 1.5*y2 + 0.5*y3
+			b := y0 - 2.5*y1 + 2*y2 - 0.5*y3
+			d := -0.5*y0 + 0.5*y2
+
+			out = append(out, ((a*t+b)*t+d)*t+y1)
+		}
+	}
+
+	r.pos -= float64(total - 3)
+	r.history = append(r.history[:0], buf[(total-3)*channels:]...)
+
+	return out
+}
+
+// ResamplerProcess applies the channel matrix to the audio packet p and
+// converts it to the given sample rate. A rate of 0 keeps the rate of p.
+// Drift stretches the audio by the given ratio on top of that.
+func (r *Resampler) ResamplerProcess(p *Packet, matrix [][]float32, rate int, drift float64) {
+	inRate := int(p.WaveHeader.SampleRate)
+
+	if rate == 0 {
+		rate = inRate
+	}
+
+	if matrix == nil && rate == inRate && drift == 1 {
+		r.channels = 0
+		return
+	}
+
+	samples := waveToFloat(p)
+	speakers := int(p.WaveHeader.Speakers)
+	channels := int(C.get_audio_channels(C.enum_speaker_layout(speakers)))
+
+	if samples == nil || channels == 0 {
+		return
+	}
+
+	if matrix != nil {
+		samples = applyMatrix(samples, channels, matrix)
+		channels = len(matrix)
+		speakers = channels
+	}
+
+	if rate != inRate || drift != 1 {
+		samples = r.resample(samples, channels, inRate, rate, drift, p.Header.Timestamp)
+	} else {
+		r.channels = 0
+	}
+
+	p.Buffer = make([]byte, len(samples)*4)
+
+	for i, v := range samples {
+		binary.LittleEndian.PutUint32(p.Buffer[i*4:], math.Float32bits(v))
+	}
+
+	p.Header.Size = int32(len(p.Buffer))
+	p.WaveHeader.Format = C.AUDIO_FORMAT_FLOAT
+	p.WaveHeader.SampleRate = int32(rate)
+	p.WaveHeader.Speakers = int32(speakers)
+	p.WaveHeader.Frames = int32(len(samples) / channels)
+}
@@ -0,0 +1,346 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Lossless audio coding in the spirit of FLAC: every channel is run through
+// the best of the fixed polynomial predictors (order 0 to 4) and the
+// residuals are Rice coded in partitions with their own parameter.
+//
+// Per channel the stream holds the predictor order as one byte, the warm-up
+// samples as zigzag varints and the byte aligned Rice coded residuals.
+// Float samples are mapped onto integers with the same ordering, so the
+// predictor still works on them and the round trip stays bit exact.
+
+const (
+	riceMaxOrder      = 4
+	riceMaxParameter  = 40
+	ricePartitionSize = 256
+	riceMaxFrames     = 192000 // a second at the highest sample rate
+)
+
+var errRiceCorrupt = errors.New("corrupt lossless audio")
+
+type bitWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+}
+
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for n > 0 {
+		c := min(n, 32)
+		n -= c
+
+		w.acc = w.acc<<c | (v>>n)&(1<<c-1)
+		w.n += c
+
+		for w.n >= 8 {
+			w.n -= 8
+			w.buf = append(w.buf, byte(w.acc>>w.n))
+		}
+	}
+}
+
+func (w *bitWriter) writeUnary(q uint64) {
+	for q >= 32 {
+		w.writeBits(0, 32)
+		q -= 32
+	}
+	w.writeBits(1, uint(q)+1)
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.n > 0 {
+		w.buf = append(w.buf, byte(w.acc<<(8-w.n)))
+	}
+
+	w.acc = 0
+	w.n = 0
+
+	return w.buf
+}
+
+type bitReader struct {
+	buf []byte
+	pos int
+	acc uint64
+	n   uint
+}
+
+func (r *bitReader) readBit() (uint64, error) {
+	if r.n == 0 {
+		if r.pos >= len(r.buf) {
+			return 0, errRiceCorrupt
+		}
+		r.acc = uint64(r.buf[r.pos])
+		r.pos++
+		r.n = 8
+	}
+
+	r.n--
+
+	return (r.acc >> r.n) & 1, nil
+}
+
+func (r *bitReader) readBits(n uint) (uint64, error) {
+	v := uint64(0)
+
+	for i := uint(0); i < n; i++ {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | b
+	}
+
+	return v, nil
+}
+
+func (r *bitReader) readUnary() (uint64, error) {
+	q := uint64(0)
+
+	for {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			return q, nil
+		}
+		q++
+	}
+}
+
+// align drops the remaining bits of the current byte.
+func (r *bitReader) align() {
+	r.n = 0
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func riceSampleToInt(wave []byte, sampleSize int, float bool) int64 {
+	switch sampleSize {
+	case 1:
+		return int64(wave[0]) - 128
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(wave)))
+	case 3:
+		return int64(int32(uint32(wave[0])<<8|uint32(wave[1])<<16|uint32(wave[2])<<24) >> 8)
+	default:
+		v := binary.LittleEndian.Uint32(wave)
+		if float && v&0x80000000 != 0 {
+			// keep the ordering of negative floats, -0 maps to -1
+			return -1 - int64(v&0x7fffffff)
+		}
+		return int64(int32(v))
+	}
+}
+
+func riceIntToSample(wave []byte, v int64, sampleSize int, float bool) {
+	switch sampleSize {
+	case 1:
+		wave[0] = byte(v + 128)
+	case 2:
+		binary.LittleEndian.PutUint16(wave, uint16(v))
+	case 3:
+		wave[0] = byte(v)
+		wave[1] = byte(v >> 8)
+		wave[2] = byte(v >> 16)
+	default:
+		if float && v < 0 {
+			binary.LittleEndian.PutUint32(wave, uint32(-1-v)|0x80000000)
+		} else {
+			binary.LittleEndian.PutUint32(wave, uint32(v))
+		}
+	}
+}
+
+func ricePredict(x []int64, i int, order int) int64 {
+	switch order {
+	case 1:
+		return x[i-1]
+	case 2:
+		return 2*x[i-1] - x[i-2]
+	case 3:
+		return 3*x[i-1] - 3*x[i-2] + x[i-3]
+	case 4:
+		return 4*x[i-1] - 6*x[i-2] + 4*x[i-3] - x[i-4]
+	}
+
+	return 0
+}
+
+func riceParameter(residuals []uint64) uint {
+	best := uint(0)
+	bestCost := uint64(math.MaxUint64)
+
+	for k := uint(0); k <= riceMaxParameter; k++ {
+		cost := uint64(len(residuals)) * uint64(k+1)
+		for _, v := range residuals {
+			cost += v >> k
+		}
+
+		if cost < bestCost {
+			best = k
+			bestCost = cost
+		}
+	}
+
+	return best
+}
+
+// riceEncode compresses interleaved little endian PCM.
+func riceEncode(wave []byte, channels int, sampleSize int, float bool) []byte {
+	frames := len(wave) / (channels * sampleSize)
+
+	x := make([]int64, frames)
+	residuals := make([]uint64, frames)
+
+	w := bitWriter{}
+
+	for c := 0; c < channels; c++ {
+		for i := 0; i < frames; i++ {
+			x[i] = riceSampleToInt(wave[(i*channels+c)*sampleSize:], sampleSize, float)
+		}
+
+		order := 0
+		best := uint64(math.MaxUint64)
+
+		for o := 0; o <= min(riceMaxOrder, frames); o++ {
+			sum := uint64(0)
+			for i := o; i < frames && sum < best; i++ {
+				sum += zigzag(x[i] - ricePredict(x, i, o))
+			}
+
+			if sum < best {
+				order = o
+				best = sum
+			}
+		}
+
+		w.buf = append(w.buf, byte(order))
+
+		for i := 0; i < order; i++ {
+			w.buf = binary.AppendUvarint(w.buf, zigzag(x[i]))
+		}
+
+		for i := order; i < frames; i++ {
+			residuals[i] = zigzag(x[i] - ricePredict(x, i, order))
+		}
+
+		for start := order; start < frames; start += ricePartitionSize {
+			partition := residuals[start:min(start+ricePartitionSize, frames)]
+
+			k := riceParameter(partition)
+			w.writeBits(uint64(k), 8)
+
+			for _, v := range partition {
+				w.writeUnary(v >> k)
+				w.writeBits(v, k)
+			}
+		}
+
+		w.flush()
+	}
+
+	return w.buf
+}
+
+// riceDecode restores interleaved little endian PCM of the given size.
+func riceDecode(data []byte, frames int, channels int, sampleSize int, float bool) ([]byte, error) {
+	// every sample takes at least a bit, check before allocating
+	if frames < 0 || frames > riceMaxFrames || channels <= 0 || frames*channels > len(data)*8 {
+		return nil, errRiceCorrupt
+	}
+
+	wave := make([]byte, frames*channels*sampleSize)
+	x := make([]int64, frames)
+
+	r := bitReader{
+		buf: data,
+	}
+
+	for c := 0; c < channels; c++ {
+		if r.pos >= len(r.buf) {
+			return nil, errRiceCorrupt
+		}
+
+		order := int(r.buf[r.pos])
+		r.pos++
+
+		if order > riceMaxOrder || order > frames {
+			return nil, errRiceCorrupt
+		}
+
+		for i := 0; i < order; i++ {
+			v, n := binary.Uvarint(r.buf[r.pos:])
+			if n <= 0 {
+				return nil, errRiceCorrupt
+			}
+			r.pos += n
+			x[i] = unzigzag(v)
+		}
+
+		for start := order; start < frames; start += ricePartitionSize {
+			k, err := r.readBits(8)
+			if err != nil {
+				return nil, err
+			}
+			if k > riceMaxParameter {
+				return nil, errRiceCorrupt
+			}
+
+			for i := start; i < min(start+ricePartitionSize, frames); i++ {
+				q, err := r.readUnary()
+				if err != nil {
+					return nil, err
+				}
+
+				low, err := r.readBits(uint(k))
+				if err != nil {
+					return nil, err
+				}
+
+				x[i] = unzigzag(q<<k|low) + ricePredict(x, i, order)
+			}
+		}
+
+		r.align()
+
+		for i := 0; i < frames; i++ {
+			riceIntToSample(wave[(i*channels+c)*sampleSize:], x[i], sampleSize, float)
+		}
+	}
+
+	return wave, nil
+}
@@ -0,0 +1,275 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+type riceFormat struct {
+	name       string
+	sampleSize int
+	float      bool
+}
+
+var riceFormats = []riceFormat{
+	{"u8", 1, false},
+	{"s16", 2, false},
+	{"s24", 3, false},
+	{"s32", 4, false},
+	{"float", 4, true},
+}
+
+// riceExtremes returns the raw little endian bit patterns of the smallest
+// and largest sample of a format.
+func riceExtremes(f riceFormat) ([]byte, []byte) {
+	lo := make([]byte, f.sampleSize)
+	hi := make([]byte, f.sampleSize)
+
+	switch {
+	case f.sampleSize == 1:
+		lo[0] = 0x00
+		hi[0] = 0xff
+	case f.float:
+		binary.LittleEndian.PutUint32(lo, math.Float32bits(-math.MaxFloat32))
+		binary.LittleEndian.PutUint32(hi, math.Float32bits(math.MaxFloat32))
+	default:
+		lo[f.sampleSize-1] = 0x80
+		for i := range hi {
+			hi[i] = 0xff
+		}
+		hi[f.sampleSize-1] = 0x7f
+	}
+
+	return lo, hi
+}
+
+func riceSignals(f riceFormat, frames int, channels int) map[string][]byte {
+	n := frames * channels
+	r := rand.New(rand.NewSource(int64(n)))
+
+	signals := map[string][]byte{
+		"zero":   make([]byte, n*f.sampleSize),
+		"noise":  make([]byte, n*f.sampleSize),
+		"sine":   make([]byte, n*f.sampleSize),
+		"minmax": make([]byte, n*f.sampleSize),
+	}
+
+	r.Read(signals["noise"])
+
+	lo, hi := riceExtremes(f)
+
+	for i := 0; i < n; i++ {
+		b := signals["minmax"][i*f.sampleSize:]
+		if i%2 == 0 {
+			copy(b, lo)
+		} else {
+			copy(b, hi)
+		}
+
+		v := math.Sin(float64(i/channels) / 10)
+		b = signals["sine"][i*f.sampleSize:]
+		if f.float {
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+		} else {
+			riceIntToSample(b, int64(v*float64(int64(1)<<(f.sampleSize*8-2))), f.sampleSize, false)
+		}
+	}
+
+	if f.float {
+		special := []float32{
+			float32(math.Copysign(0, -1)),
+			0,
+			float32(math.Inf(1)),
+			float32(math.Inf(-1)),
+			math.SmallestNonzeroFloat32,
+			-math.SmallestNonzeroFloat32,
+			float32(math.NaN()),
+		}
+
+		signals["special"] = make([]byte, n*f.sampleSize)
+		for i := 0; i < n; i++ {
+			binary.LittleEndian.PutUint32(signals["special"][i*4:], math.Float32bits(special[i%len(special)]))
+		}
+
+		signals["negzero"] = make([]byte, n*f.sampleSize)
+		for i := 0; i < n; i++ {
+			binary.LittleEndian.PutUint32(signals["negzero"][i*4:], 0x80000000)
+		}
+	}
+
+	return signals
+}
+
+func TestRiceRoundTrip(t *testing.T) {
+	for _, f := range riceFormats {
+		for channels := 1; channels <= 8; channels++ {
+			for _, frames := range []int{0, 1, 3, 5, 255, 257, 1023} {
+				for name, wave := range riceSignals(f, frames, channels) {
+					t.Run(fmt.Sprintf("%s/%dch/%d/%s", f.name, channels, frames, name), func(t *testing.T) {
+						data := riceEncode(wave, channels, f.sampleSize, f.float)
+
+						out, err := riceDecode(data, frames, channels, f.sampleSize, f.float)
+						if err != nil {
+							t.Fatal(err)
+						}
+
+						if !bytes.Equal(out, wave) {
+							t.Fatal("round trip is not bit exact")
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestRiceCompresses(t *testing.T) {
+	for _, f := range riceFormats {
+		wave := riceSignals(f, 1024, 2)["sine"]
+
+		data := riceEncode(wave, 2, f.sampleSize, f.float)
+		if len(data) >= len(wave) {
+			t.Errorf("%s: %d bytes encoded to %d", f.name, len(wave), len(data))
+		}
+	}
+}
+
+func TestRiceDecodeCorrupt(t *testing.T) {
+	wave := riceSignals(riceFormats[1], 64, 2)["noise"]
+	data := riceEncode(wave, 2, 2, false)
+
+	for i := 0; i < len(data); i++ {
+		_, err := riceDecode(data[:i], 64, 2, 2, false)
+		if err == nil {
+			t.Fatalf("truncated to %d bytes decoded without error", i)
+		}
+	}
+}
+
+// OBS enum values, cgo is not available in tests
+const (
+	riceTestFormat16Bit     = 2 // AUDIO_FORMAT_16BIT
+	riceTestFormatFloat     = 4 // AUDIO_FORMAT_FLOAT
+	riceTestSpeakersStereo  = 2 // SPEAKERS_STEREO
+	riceTestSpeakers5Point1 = 6 // SPEAKERS_5POINT1
+)
+
+func riceTestPacket(wave []byte, format int32, speakers int32, frames int32) *Packet {
+	p := &Packet{
+		Header: Header{
+			Type:      [4]byte{'W', 'A', 'V', 'E'},
+			Timestamp: 1234,
+			Size:      int32(len(wave)),
+		},
+		WaveHeader: WaveHeader{
+			Format:     format,
+			SampleRate: 48000,
+			Speakers:   speakers,
+			Frames:     frames,
+			Track:      3,
+		},
+	}
+
+	h := bytes.Buffer{}
+
+	binary.Write(&h, binary.LittleEndian, &p.Header)
+	binary.Write(&h, binary.LittleEndian, &p.WaveHeader)
+
+	p.Buffer = append(h.Bytes(), wave...)
+
+	return p
+}
+
+func TestRicePacketRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		format   int32
+		speakers int32
+		channels int
+		f        riceFormat
+	}{
+		{riceTestFormat16Bit, riceTestSpeakersStereo, 2, riceFormats[1]},
+		{riceTestFormatFloat, riceTestSpeakersStereo, 2, riceFormats[4]},
+		{riceTestFormat16Bit, riceTestSpeakers5Point1, 6, riceFormats[1]},
+		{riceTestFormatFloat, riceTestSpeakers5Point1, 6, riceFormats[4]},
+	} {
+		wave := riceSignals(c.f, 480, c.channels)["sine"]
+		p := riceTestPacket(wave, c.format, c.speakers, 480)
+
+		b := p.ToRICE()
+		if string(b[:4]) != "RICE" {
+			t.Fatalf("format %d, speakers %d: not compressed", c.format, c.speakers)
+		}
+
+		q, err := readPacket(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = q.FromRICE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if q.Header.Type != p.Header.Type || q.Header.Size != p.Header.Size || q.WaveHeader != p.WaveHeader {
+			t.Fatalf("format %d, speakers %d: headers differ", c.format, c.speakers)
+		}
+
+		if !bytes.Equal(q.Buffer, wave) {
+			t.Fatalf("format %d, speakers %d: round trip is not bit exact", c.format, c.speakers)
+		}
+	}
+}
+
+func TestRicePacketRejectsBadHeaders(t *testing.T) {
+	wave := riceSignals(riceFormats[1], 480, 2)["sine"]
+
+	for name, modify := range map[string]func(h *WaveHeader){
+		"unknown format":   func(h *WaveHeader) { h.Format = 99 },
+		"unknown speakers": func(h *WaveHeader) { h.Speakers = 99 },
+		"no speakers":      func(h *WaveHeader) { h.Speakers = 0 },
+		"negative frames":  func(h *WaveHeader) { h.Frames = -1 },
+		"too many frames":  func(h *WaveHeader) { h.Frames = 48001 },
+		"huge frames": func(h *WaveHeader) {
+			h.SampleRate = math.MaxInt32
+			h.Frames = math.MaxInt32
+		},
+		"frames exceed data": func(h *WaveHeader) { h.Frames = 48000 },
+	} {
+		p := riceTestPacket(wave, riceTestFormat16Bit, riceTestSpeakersStereo, 480)
+
+		q, err := readPacket(bytes.NewReader(p.ToRICE()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		modify(&q.WaveHeader)
+
+		if q.FromRICE() == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"math"
+)
+
+const (
+	scalePoint = iota
+	scaleBilinear
+	scaleBicubic
+	scaleArea
+)
+
+type ScaleSettings struct {
+	CropLeft   int
+	CropTop    int
+	CropRight  int
+	CropBottom int
+	Width      int
+	Height     int
+	Algorithm  int
+}
+
+type scaleWeights struct {
+	taps    int
+	index   []int
+	weights []int32
+}
+
+const scaleBits = 14
+
+func scaleKernel(algorithm int, x float64) float64 {
+	x = math.Abs(x)
+
+	switch algorithm {
+	case scaleBilinear:
+		if x < 1 {
+			return 1 - x
+		}
+	case scaleBicubic:
+		// Keys cubic, a = -0.5
+		if x < 1 {
+			return 1.5*x*x*x - 2.5*x*x + 1
+		} else if x < 2 {
+			return -0.5*x*x*x + 2.5*x*x - 4*x + 2
+		}
+	case scaleArea:
+		if x < 0.5 {
+			return 1
+		} else if x == 0.5 {
+			return 0.5
+		}
+	}
+
+	return 0
+}
+
+func newScaleWeights(dst int, src int, algorithm int) scaleWeights {
+	ratio := float64(src) / float64(dst)
+
+	if algorithm == scalePoint {
+		w := scaleWeights{
+			taps:    1,
+			index:   make([]int, dst),
+			weights: make([]int32, dst),
+		}
+
+		for i := 0; i < dst; i++ {
+			w.index[i] = min(int((float64(i)+0.5)*ratio), src-1)
+			w.weights[i] = 1 << scaleBits
+		}
+
+		return w
+	}
+
+	radius := 0.5
+	switch algorithm {
+	case scaleBilinear:
+		radius = 1
+	case scaleBicubic:
+		radius = 2
+	}
+
+	// widen the kernel when downscaling so every source pixel contributes
+	scale := max(ratio, 1)
+	taps := int(math.Ceil(radius*scale))*2 + 1
+
+	w := scaleWeights{
+		taps:    taps,
+		index:   make([]int, dst*taps),
+		weights: make([]int32, dst*taps),
+	}
+
+	f := make([]float64, taps)
+
+	for i := 0; i < dst; i++ {
+		center := (float64(i)+0.5)*ratio - 0.5
+		start := int(math.Floor(center)) - taps/2
+
+		sum := 0.0
+		for k := 0; k < taps; k++ {
+			f[k] = scaleKernel(algorithm, (float64(start+k)-center)/scale)
+			sum += f[k]
+		}
+
+		total := int32(0)
+		peak := 0
+
+		for k := 0; k < taps; k++ {
+			w.index[i*taps+k] = min(max(start+k, 0), src-1)
+			w.weights[i*taps+k] = int32(math.Round(f[k] / sum * (1 << scaleBits)))
+
+			total += w.weights[i*taps+k]
+			if w.weights[i*taps+k] > w.weights[i*taps+peak] {
+				peak = k
+			}
+		}
+
+		// make sure the weights sum up to exactly one
+		w.weights[i*taps+peak] += 1<<scaleBits - total
+	}
+
+	return w
+}
+
+func scalePlane(dst []byte, dw int, dh int, src []byte, stride int, rect image.Rectangle, channels int, algorithm int) {
+	sw := rect.Dx()
+	sh := rect.Dy()
+
+	wx := newScaleWeights(dw, sw, algorithm)
+	wy := newScaleWeights(dh, sh, algorithm)
+
+	tmp := make([]byte, dw*channels*sh)
+
+	for y := 0; y < sh; y++ {
+		row := src[(rect.Min.Y+y)*stride+rect.Min.X*channels:]
+		out := tmp[y*dw*channels:]
+
+		for x := 0; x < dw; x++ {
+			for c := 0; c < channels; c++ {
+				sum := int32(0)
+				for k := 0; k < wx.taps; k++ {
+					sum += int32(row[wx.index[x*wx.taps+k]*channels+c]) * wx.weights[x*wx.taps+k]
+				}
+				out[x*channels+c] = byte(min(max((sum+1<<(scaleBits-1))>>scaleBits, 0), 255))
+			}
+		}
+	}
+
+	for y := 0; y < dh; y++ {
+		out := dst[y*dw*channels : (y+1)*dw*channels]
+
+		for x := range out {
+			sum := int32(0)
+			for k := 0; k < wy.taps; k++ {
+				sum += int32(tmp[wy.index[y*wy.taps+k]*dw*channels+x]) * wy.weights[y*wy.taps+k]
+			}
+			out[x] = byte(min(max((sum+1<<(scaleBits-1))>>scaleBits, 0), 255))
+		}
+	}
+}
+
+// scaleImage returns a cropped and resized copy of img backed by a buffer
+// from the pool. It returns nil if s would not change the image.
+func scaleImage(pool *Pool, img image.Image, s ScaleSettings) (image.Image, *bytes.Buffer) {
+	bounds := img.Bounds()
+
+	// keep everything even so chroma planes stay aligned
+	rect := image.Rect(
+		s.CropLeft&^1,
+		s.CropTop&^1,
+		bounds.Dx()-s.CropRight&^1,
+		bounds.Dy()-s.CropBottom&^1,
+	).Intersect(bounds)
+
+	width := s.Width
+	height := s.Height
+
+	if rect.Dx() < 2 || rect.Dy() < 2 {
+		return nil, nil
+	}
+
+	switch {
+	case width == 0 && height == 0:
+		width = rect.Dx()
+		height = rect.Dy()
+	case width == 0:
+		width = height * rect.Dx() / rect.Dy()
+	case height == 0:
+		height = width * rect.Dy() / rect.Dx()
+	}
+
+	width = max(width&^1, 2)
+	height = max(height&^1, 2)
+
+	if rect == bounds && width == bounds.Dx() && height == bounds.Dy() {
+		return nil, nil
+	}
+
+	b := pool.Get().(*bytes.Buffer)
+
+	dst := image.Rectangle{
+		Max: image.Point{
+			X: width,
+			Y: height,
+		},
+	}
+
+	switch img := img.(type) {
+	case *image.YCbCr:
+		cw := width
+		ch := height
+		crect := rect
+
+		switch img.SubsampleRatio {
+		case image.YCbCrSubsampleRatio420:
+			cw /= 2
+			ch /= 2
+			crect = image.Rect(rect.Min.X/2, rect.Min.Y/2, rect.Max.X/2, rect.Max.Y/2)
+		case image.YCbCrSubsampleRatio422:
+			cw /= 2
+			crect = image.Rect(rect.Min.X/2, rect.Min.Y, rect.Max.X/2, rect.Max.Y)
+		case image.YCbCrSubsampleRatio444:
+		default:
+			panic(errors.New("invalid subsampling"))
+		}
+
+		b.Grow(width*height + 2*cw*ch)
+		buf := b.Bytes()[:width*height+2*cw*ch]
+
+		Y := buf[:width*height]
+		Cb := buf[width*height : width*height+cw*ch]
+		Cr := buf[width*height+cw*ch:]
+
+		scalePlane(Y, width, height, img.Y, img.YStride, rect, 1, s.Algorithm)
+		scalePlane(Cb, cw, ch, img.Cb, img.CStride, crect, 1, s.Algorithm)
+		scalePlane(Cr, cw, ch, img.Cr, img.CStride, crect, 1, s.Algorithm)
+
+		return &image.YCbCr{
+			Rect:           dst,
+			YStride:        width,
+			CStride:        cw,
+			Y:              Y,
+			Cb:             Cb,
+			Cr:             Cr,
+			SubsampleRatio: img.SubsampleRatio,
+		}, b
+	case *image.RGBA:
+		b.Grow(width * height * 4)
+		Pix := b.Bytes()[:width*height*4]
+
+		scalePlane(Pix, width, height, img.Pix, img.Stride, rect, 4, s.Algorithm)
+
+		return &image.RGBA{
+			Rect:   dst,
+			Stride: width * 4,
+			Pix:    Pix,
+		}, b
+	default:
+		panic(errors.New("invalid image type"))
+	}
+}
+
+// ToScaled crops and resizes p.Image according to s. The result is stored
+// in a fresh buffer from the pool, the previous image buffer is returned.
+func (p *Packet) ToScaled(pool *Pool, s ScaleSettings) {
+	img, b := scaleImage(pool, p.Image, s)
+	if img == nil {
+		return
+	}
+
+	if p.ImageBuffer != nil {
+		pool.Put(p.ImageBuffer)
+	}
+
+	p.Image = img
+	p.ImageBuffer = b
+}
@@ -22,18 +22,166 @@ package main
 
 //
 // #include <obs-module.h>
+// #include <util/platform.h>
 //
 import "C"
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"os"
+	"slices"
 	"strconv"
 	"sync"
+	"time"
 )
 
+const (
+	senderQueueHigh = 100
+	senderQueueMax  = 800
+
+	// receivers send their request right after connecting
+	senderRequestTimeout = 2 * time.Second
+)
+
+// senderConn schedules the packets of one connection. Audio and clock sync
+// go first. Video is sent in chunks to receivers that support it, so audio
+// never waits behind more than a chunk of a large frame.
+type senderConn struct {
+	sync.Mutex
+	audio    [][]byte
+	video    [][]byte
+	current  []byte
+	offset   int
+	chunked  bool
+	closed   bool
+	signal   chan any
+	ready    bool
+	variant  string
+	custom   *Variant
+	lossless bool
+	wire     AudioWire
+}
+
+func isVideoPacket(b []byte) bool {
+	return len(b) >= 4 && string(b[:4]) == "JPEG"
+}
+
+// push queues b. Once the queue is full, new video is dropped, and queued
+// video makes room for new audio. Audio is only dropped if no video is
+// left to drop.
+func (conn *senderConn) push(c net.Conn, b []byte) {
+	conn.Lock()
+	defer conn.Unlock()
+
+	if conn.closed {
+		return
+	}
+
+	queued := len(conn.audio) + len(conn.video)
+
+	if queued > senderQueueMax {
+		if isVideoPacket(b) {
+			blog(C.LOG_WARNING, "send queue exceeded ["+c.RemoteAddr().String()+"] "+strconv.Itoa(queued))
+			return
+		}
+
+		if len(conn.video) == 0 {
+			blog(C.LOG_WARNING, "send queue exceeded, dropping audio ["+c.RemoteAddr().String()+"] "+strconv.Itoa(queued))
+			return
+		}
+
+		blog(C.LOG_WARNING, "send queue exceeded, dropping "+strconv.Itoa(len(conn.video))+" video packets ["+c.RemoteAddr().String()+"]")
+		conn.video = nil
+	} else if queued > senderQueueHigh {
+		blog(C.LOG_WARNING, "send queue high ["+c.RemoteAddr().String()+"] "+strconv.Itoa(queued))
+	}
+
+	if isVideoPacket(b) {
+		conn.video = append(conn.video, b)
+	} else {
+		conn.audio = append(conn.audio, b)
+	}
+
+	select {
+	case conn.signal <- nil:
+	default:
+	}
+}
+
+// pop returns the next packet or chunk to write. It reports false once the
+// connection is closed and everything queued is written.
+func (conn *senderConn) pop() ([]byte, bool) {
+	conn.Lock()
+	defer conn.Unlock()
+
+	if len(conn.audio) > 0 {
+		b := conn.audio[0]
+		conn.audio[0] = nil
+		conn.audio = conn.audio[1:]
+
+		return b, true
+	}
+
+	if conn.current == nil && len(conn.video) > 0 {
+		// stamp a copy, the packet is shared with other connections
+		conn.current = bytes.Clone(conn.video[0])
+		stampEncoded(conn.current)
+		conn.offset = 0
+		conn.video[0] = nil
+		conn.video = conn.video[1:]
+	}
+
+	if conn.current != nil {
+		var b []byte
+
+		if conn.chunked && len(conn.current) > chunkSize {
+			b, conn.offset = chunkPacket(conn.current, conn.offset)
+		} else {
+			b, conn.offset = conn.current, len(conn.current)
+		}
+
+		if conn.offset == len(conn.current) {
+			conn.current = nil
+		}
+
+		return b, true
+	}
+
+	return nil, !conn.closed
+}
+
+func (conn *senderConn) close() {
+	conn.Lock()
+	defer conn.Unlock()
+
+	conn.closed = true
+
+	select {
+	case conn.signal <- nil:
+	default:
+	}
+}
+
 type Sender struct {
 	sync.Mutex
 	sync.WaitGroup
-	conns map[net.Conn]chan []byte
+	conns      map[net.Conn]*senderConn
+	decimators map[string]*Decimator
+	variants   []Variant
+}
+
+// SenderSetVariants sets the announced variants that receiver requests are
+// derived from.
+func (s *Sender) SenderSetVariants(variants []Variant) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.variants = variants
 }
 
 func (s *Sender) SenderAdd(c net.Conn) {
@@ -43,18 +191,31 @@ func (s *Sender) SenderAdd(c net.Conn) {
 	blog(C.LOG_INFO, "connect: "+c.RemoteAddr().String())
 
 	if s.conns == nil {
-		s.conns = make(map[net.Conn]chan []byte)
+		s.conns = make(map[net.Conn]*senderConn)
 	}
 
-	ch := make(chan []byte, 1000)
-	s.conns[c] = ch
+	conn := &senderConn{
+		signal: make(chan any, 1),
+	}
+	s.conns[c] = conn
 
 	s.Add(1)
 	go func() {
 		defer s.Done()
 		defer c.Close()
 
-		for b := range ch {
+		for {
+			b, ok := conn.pop()
+			if !ok {
+				break
+			}
+			if b == nil {
+				<-conn.signal
+				continue
+			}
+
+			stampSync(b)
+
 			_, err := c.Write(b)
 			if err != nil {
 				blog(C.LOG_INFO, "disconnect: "+c.RemoteAddr().String())
@@ -66,6 +227,115 @@ func (s *Sender) SenderAdd(c net.Conn) {
 			}
 		}
 	}()
+
+	// drop receivers that never ask for a stream of our protocol version
+	c.SetReadDeadline(time.Now().Add(senderRequestTimeout))
+
+	s.Add(1)
+	go func() {
+		defer s.Done()
+		defer s.senderDrop(c, conn)
+
+		for {
+			var header Header
+
+			err := binary.Read(c, binary.LittleEndian, &header)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				blog(C.LOG_WARNING, "no stream request, incompatible receiver? ["+c.RemoteAddr().String()+"]")
+				return
+			}
+			if err != nil || header.Size < 0 || header.Size > 1<<20 {
+				return
+			}
+
+			receive := uint64(C.os_gettime_ns())
+
+			buf := make([]byte, header.Size)
+
+			_, err = io.ReadFull(c, buf)
+			if err != nil {
+				return
+			}
+
+			switch header.Type {
+			case [4]byte{'C', 'T', 'R', 'L'}:
+				var j ControlPayload
+
+				err = json.Unmarshal(buf, &j)
+				if err != nil {
+					blog(C.LOG_WARNING, "invalid control message ["+c.RemoteAddr().String()+"]")
+					continue
+				}
+
+				if j.Protocol != protocolVersion {
+					blog(C.LOG_WARNING, "protocol mismatch ["+c.RemoteAddr().String()+"] "+strconv.Itoa(j.Protocol)+" != "+strconv.Itoa(protocolVersion))
+					return
+				}
+
+				c.SetReadDeadline(time.Time{})
+
+				s.Lock()
+				conn.ready = true
+				conn.variant = j.Variant
+				conn.custom = nil
+				conn.lossless = slices.Contains(j.Codecs, "lossless")
+				conn.wire = AudioWire{}
+
+				if j.SampleRate >= 8000 && j.SampleRate <= 192000 {
+					conn.wire.SampleRate = j.SampleRate
+				}
+				if j.Speakers == C.SPEAKERS_MONO || j.Speakers == C.SPEAKERS_STEREO {
+					conn.wire.Speakers = j.Speakers
+				}
+
+				// explicit requests get their own variant, derived from the
+				// selected announced variant or else the main stream
+				if j.Quality != 0 || j.Height != 0 || j.MaxFPS != 0 {
+					var v Variant
+					for _, a := range s.variants {
+						if a.Name == j.Variant {
+							v = a
+						}
+					}
+					if j.Height != 0 {
+						v.Height = j.Height
+					}
+					if j.Quality != 0 {
+						v.Quality = j.Quality
+					}
+					if j.MaxFPS != 0 {
+						v.MaxFPS = j.MaxFPS
+					}
+					v.Name = fmt.Sprintf("custom/%s/%dp/q%d/%dfps", j.Variant, v.Height, v.Quality, v.MaxFPS)
+
+					conn.custom = &v
+					conn.variant = v.Name
+				}
+				s.Unlock()
+
+				conn.Lock()
+				conn.chunked = slices.Contains(j.Codecs, "chunked")
+				conn.Unlock()
+
+				blog(C.LOG_INFO, "subscribe ["+c.RemoteAddr().String()+"] variant: "+conn.variant)
+			case [4]byte{'S', 'Y', 'N', 'C'}:
+				var j SyncPayload
+
+				err = binary.Read(bytes.NewReader(buf), binary.LittleEndian, &j)
+				if err != nil {
+					continue
+				}
+
+				j.Receive = receive
+
+				s.Lock()
+				if s.conns[c] == conn {
+					s.senderQueue(c, conn, syncPacket(j))
+				}
+				s.Unlock()
+			}
+		}
+	}()
 }
 
 func (s *Sender) SenderGetNumConns() int {
@@ -75,27 +345,143 @@ func (s *Sender) SenderGetNumConns() int {
 	return len(s.conns)
 }
 
-func (s *Sender) SenderSend(b []byte) {
+// SenderGetVariants returns all variants that have at least one subscriber
+// and are due for a frame at timestamp. The empty name is the main stream.
+// Variants requested by a receiver carry their settings, announced
+// variants map to nil.
+func (s *Sender) SenderGetVariants(timestamp uint64) map[string]*Variant {
+	s.Lock()
+	defer s.Unlock()
+
+	variants := map[string]*Variant{}
+
+	for _, conn := range s.conns {
+		if conn.ready {
+			variants[conn.variant] = conn.custom
+		}
+	}
+
+	for name := range s.decimators {
+		if _, ok := variants[name]; !ok {
+			delete(s.decimators, name)
+		}
+	}
+
+	for name, v := range variants {
+		if v == nil || v.MaxFPS == 0 {
+			continue
+		}
+
+		if s.decimators == nil {
+			s.decimators = make(map[string]*Decimator)
+		}
+
+		d, ok := s.decimators[name]
+		if !ok {
+			d = &Decimator{}
+			s.decimators[name] = d
+		}
+
+		if !d.DecimatorAccept(timestamp, v.MaxFPS) {
+			delete(variants, name)
+		}
+	}
+
+	return variants
+}
+
+// SenderGetAudioWires returns the audio wire formats of all connections.
+func (s *Sender) SenderGetAudioWires() map[AudioWire]bool {
+	s.Lock()
+	defer s.Unlock()
+
+	wires := map[AudioWire]bool{}
+
+	for _, conn := range s.conns {
+		if conn.ready {
+			wires[conn.wire] = true
+		}
+	}
+
+	return wires
+}
+
+// SenderSendAudio sends b to all connections that asked for the audio wire
+// format, regardless of their variant.
+func (s *Sender) SenderSendAudio(wire AudioWire, b []byte) {
 	s.Lock()
 	defer s.Unlock()
 
-	for c, ch := range s.conns {
-		if len(ch) > 800 {
-			blog(C.LOG_WARNING, "send queue exceeded ["+c.RemoteAddr().String()+"] "+strconv.Itoa(len(ch)))
+	for c, conn := range s.conns {
+		if conn.wire != wire {
 			continue
-		} else if len(ch) > 100 {
-			blog(C.LOG_WARNING, "send queue high ["+c.RemoteAddr().String()+"] "+strconv.Itoa(len(ch)))
 		}
 
-		ch <- b
+		s.senderQueue(c, conn, b)
 	}
 }
 
+// SenderSendVariant sends b to all connections subscribed to variant.
+func (s *Sender) SenderSendVariant(variant string, b []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	for c, conn := range s.conns {
+		if conn.variant != variant {
+			continue
+		}
+
+		s.senderQueue(c, conn, b)
+	}
+}
+
+// SenderSendLossless sends the losslessly compressed b to all connections
+// of the audio wire format that support it, and the uncompressed fallback
+// to all others.
+func (s *Sender) SenderSendLossless(wire AudioWire, b []byte, fallback []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	for c, conn := range s.conns {
+		if conn.wire != wire {
+			continue
+		}
+
+		if conn.lossless {
+			s.senderQueue(c, conn, b)
+		} else {
+			s.senderQueue(c, conn, fallback)
+		}
+	}
+}
+
+// senderQueue queues b for connections that made a valid request.
+func (s *Sender) senderQueue(c net.Conn, conn *senderConn, b []byte) {
+	if !conn.ready {
+		return
+	}
+
+	conn.push(c, b)
+}
+
+// senderDrop removes the connection once its reader is done, the writer
+// closes it.
+func (s *Sender) senderDrop(c net.Conn, conn *senderConn) {
+	s.Lock()
+	if s.conns[c] == conn {
+		blog(C.LOG_INFO, "disconnect: "+c.RemoteAddr().String())
+		delete(s.conns, c)
+	}
+	s.Unlock()
+
+	conn.close()
+}
+
 func (s *Sender) SenderClose() {
 	s.Lock()
 
-	for _, ch := range s.conns {
-		close(ch)
+	for _, conn := range s.conns {
+		conn.close()
 	}
 
 	s.conns = nil
@@ -22,13 +22,16 @@ package main
 
 //
 // #include <obs-module.h>
+// #include <util/platform.h>
 //
 // extern bool refresh_list(obs_properties_t *props, obs_property_t *property, uintptr_t data);
+// extern bool channel_map_callback(obs_properties_t *properties, obs_property_t *prop, obs_data_t *settings);
 //
 import "C"
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
@@ -40,6 +43,7 @@ import (
 	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -54,6 +58,13 @@ type teleportSource struct {
 	sync.Mutex
 	sync.WaitGroup
 	Discoverer
+	AudioLevels
+	ClockSync
+	LatencyStats
+	JitterBuffer
+	DelayBuffer
+	CalibrationDetector
+	Lockstep
 	done            chan any
 	services        map[string]Peer
 	source          *C.obs_source_t
@@ -64,6 +75,13 @@ type teleportSource struct {
 	isStart         bool
 	isAudioAndVideo bool
 	offset          uint64
+	avOffset        time.Duration
+	catchUp         time.Duration
+	dropped         uint64
+	lastDropped     time.Time
+	calibrate       bool
+	calibrateApply  bool
+	timecode        Timecode
 	pool            *Pool
 }
 
@@ -72,6 +90,81 @@ var (
 	refresh_readable_str = C.CString("Refresh List")
 	no_services_str      = C.CString("Press 'Refresh List' to search for streams")
 	disabled_str         = C.CString("- Disabled -")
+
+	request_quality_str          = C.CString("request_quality")
+	request_quality_readable_str = C.CString("Requested Quality")
+	request_height_str           = C.CString("request_height")
+	request_height_readable_str  = C.CString("Requested Resolution")
+	request_max_fps_str          = C.CString("request_max_fps")
+	request_max_fps_readable_str = C.CString("Requested Max. Frame Rate")
+	request_description_str      = C.CString("0 uses the sender's setting. Any requested value makes the sender encode a separate stream just for this connection.")
+	request_sender_default_str   = C.CString("Sender Default")
+
+	sample_rate_str                = C.CString("sample_rate")
+	sample_rate_readable_str       = C.CString("Sample Rate")
+	sample_rate_off_str            = C.CString("As Sent")
+	sample_rate_obs_str            = C.CString("Same as OBS")
+	channel_map_str                = C.CString("channel_map")
+	channel_map_readable_str       = C.CString("Channels")
+	channel_map_none_str           = C.CString("As Sent")
+	channel_map_stereo_str         = C.CString("Downmix to Stereo")
+	channel_map_mono_str           = C.CString("Downmix to Mono")
+	channel_map_swap_str           = C.CString("Swap Left and Right")
+	channel_map_left_str           = C.CString("Left to Both")
+	channel_map_right_str          = C.CString("Right to Both")
+	channel_map_custom_str         = C.CString("Custom")
+	channel_left_str               = C.CString("channel_left")
+	channel_left_readable_str      = C.CString("Left Output Channel")
+	channel_right_str              = C.CString("channel_right")
+	channel_right_readable_str     = C.CString("Right Output Channel")
+	channel_map_description_str    = C.CString("Mono input is duplicated to both channels when downmixing to stereo.")
+	channel_custom_description_str = C.CString("Input channel to use, counting from 1.")
+	drift_str                      = C.CString("drift_compensation")
+	drift_readable_str             = C.CString("Clock Drift Compensation")
+	drift_description_str          = C.CString("Slightly resamples the audio so the sender's clock keeps pace with this machine's clock over long streams.")
+	bit_exact_str                  = C.CString("bit_exact")
+	bit_exact_readable_str         = C.CString("Bit-Exact Lossless Audio")
+	bit_exact_description_str      = C.CString("Plays audio that arrived lossless or uncompressed exactly as sent, without drift compensation, resampling or channel mapping. Selecting several tracks still mixes them.")
+	reduce_audio_str               = C.CString("reduce_audio")
+	reduce_audio_readable_str      = C.CString("Reduce Audio at Sender")
+	reduce_audio_description_str   = C.CString("Asks the sender to downsample and downmix to the output format above before sending, to save bandwidth. Without it all conversion happens on this machine. Has no effect with bit-exact audio.")
+	levels_info_str                = C.CString("levels_info")
+	latency_info_str               = C.CString("latency_info")
+	jitter_buffer_str              = C.CString("jitter_buffer")
+	jitter_buffer_readable_str     = C.CString("Target Latency")
+	jitter_buffer_off_str          = C.CString("Lowest Latency")
+	catch_up_str                   = C.CString("catch_up")
+	catch_up_readable_str          = C.CString("Catch Up to Live")
+	catch_up_off_str               = C.CString("Never")
+	catch_up_description_str       = C.CString("Drops late video frames once the receiver is behind by more than this, e.g. after a CPU spike. Audio is kept unless it lags twice as much.")
+	av_offset_str                  = C.CString("av_offset")
+	av_offset_readable_str         = C.CString("Audio/Video Offset")
+	av_offset_description_str      = C.CString("Positive values play the audio later, negative values play the video later.")
+	delay_str                      = C.CString("delay")
+	delay_readable_str             = C.CString("Delay")
+	delay_description_str          = C.CString("Delays audio and video together, e.g. to line up with a slower feed.")
+	ms_str                         = C.CString(" ms")
+	lockstep_str                   = C.CString("lockstep")
+	lockstep_readable_str          = C.CString("Lockstep Latency")
+	lockstep_description_str       = C.CString("0 disables. Presents every frame this long after the sender's timestamp, on top of any delay, going by the clock shared with the sender. Receivers of the same sender with the same value update in lockstep. Replaces the target latency.")
+	calibration_info_str           = C.CString("calibration_info")
+	calibrate_str                  = C.CString("calibration_detect")
+	calibrate_readable_str         = C.CString("Detect Calibration Signal")
+	calibrate_description_str      = C.CString("Measures A/V offset and latency from the sender's calibration signal.")
+	auto_offset_str                = C.CString("calibration_apply")
+	auto_offset_readable_str       = C.CString("Apply Measured A/V Offset")
+	auto_offset_description_str    = C.CString("Adjusts the audio/video offset automatically so the calibration flash and beep line up.")
+	jitter_buffer_description_str  = C.CString("Holds packets back to even out network jitter. Grows beyond the target if the network is worse than that. 'Lowest Latency' passes everything on as soon as it is decoded.")
+	levels_signal_str              = C.CString("teleport_levels")
+	levels_signal_decl_str         = C.CString("void teleport_levels(ptr source, int track, string levels)")
+	source_param_str               = C.CString("source")
+	track_param_str                = C.CString("track")
+	levels_param_str               = C.CString("levels")
+	timecode_info_str              = C.CString("timecode_info")
+	timecode_signal_str            = C.CString("teleport_timecode")
+	timecode_signal_decl_str       = C.CString("void teleport_timecode(ptr source, string timecode, int timestamp)")
+	timecode_param_str             = C.CString("timecode")
+	timestamp_param_str            = C.CString("timestamp")
 )
 
 //export source_get_name
@@ -90,6 +183,9 @@ func source_create(settings *C.obs_data_t, source *C.obs_source_t) C.uintptr_t {
 		pool:     NewPool(10),
 	}
 
+	C.signal_handler_add(C.obs_source_get_signal_handler(source), levels_signal_decl_str)
+	C.signal_handler_add(C.obs_source_get_signal_handler(source), timecode_signal_decl_str)
+
 	h.Add(1)
 	go h.sourceLoop()
 
@@ -136,14 +232,27 @@ func refresh_list(props *C.obs_properties_t, property *C.obs_property_t, data C.
 
 	for _, k := range keys {
 		service := h.services[k]
+		incompatible := service.Payload.Protocol != protocolVersion
 
 		key := C.CString(k)
 		val := C.CString(fmt.Sprintf("%s / %s:%d", service.Payload.Name, service.Payload.Address, service.Payload.Port))
 
-		C.obs_property_list_add_string(prop, val, key)
+		idx := C.obs_property_list_add_string(prop, val, key)
+		C.obs_property_list_item_disable(prop, idx, C.bool(incompatible))
 
 		C.free(unsafe.Pointer(key))
 		C.free(unsafe.Pointer(val))
+
+		for _, v := range service.Payload.Variants {
+			key := C.CString(k + "#" + v.Name)
+			val := C.CString(fmt.Sprintf("%s / %s:%d (%s %dp)", service.Payload.Name, service.Payload.Address, service.Payload.Port, v.Name, v.Height))
+
+			idx := C.obs_property_list_add_string(prop, val, key)
+			C.obs_property_list_item_disable(prop, idx, C.bool(incompatible))
+
+			C.free(unsafe.Pointer(key))
+			C.free(unsafe.Pointer(val))
+		}
 	}
 	h.Unlock()
 
@@ -159,12 +268,172 @@ func source_get_properties(data C.uintptr_t) *C.obs_properties_t {
 
 	C.obs_properties_add_button(properties, refresh_readable_str, refresh_readable_str, C.obs_property_clicked_t(unsafe.Pointer(C.refresh_list)))
 
+	prop := C.obs_properties_add_int_slider(properties, request_quality_str, request_quality_readable_str, 0, 100, 1)
+	C.obs_property_set_long_description(prop, request_description_str)
+
+	prop = C.obs_properties_add_list(properties, request_height_str, request_height_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_set_long_description(prop, request_description_str)
+	C.obs_property_list_add_int(prop, request_sender_default_str, 0)
+
+	for _, height := range []int{360, 480, 540, 720, 1080} {
+		tmp := C.CString(strconv.Itoa(height) + "p")
+		C.obs_property_list_add_int(prop, tmp, C.longlong(height))
+		C.free(unsafe.Pointer(tmp))
+	}
+
+	prop = C.obs_properties_add_int(properties, request_max_fps_str, request_max_fps_readable_str, 0, 240, 1)
+	C.obs_property_int_set_suffix(prop, fps_str)
+	C.obs_property_set_long_description(prop, request_description_str)
+
+	track_properties(properties)
+
+	info := "Audio Levels: no signal"
+	if data != 0 {
+		info = cgo.Handle(data).Value().(*teleportSource).AudioLevelsInfo()
+	}
+
+	tmp := C.CString(info)
+	C.obs_properties_add_text(properties, levels_info_str, tmp, C.OBS_TEXT_INFO)
+	C.free(unsafe.Pointer(tmp))
+
+	info = "Latency: no data yet"
+	if data != 0 {
+		h := cgo.Handle(data).Value().(*teleportSource)
+		info = h.LatencyStatsInfo() + fmt.Sprintf("\nDropped Frames: %d", h.DroppedFrames())
+	}
+
+	tmp = C.CString(info)
+	C.obs_properties_add_text(properties, latency_info_str, tmp, C.OBS_TEXT_INFO)
+	C.free(unsafe.Pointer(tmp))
+
+	info = "Timecode: none"
+	if data != 0 {
+		info = cgo.Handle(data).Value().(*teleportSource).TimecodeInfo()
+	}
+
+	tmp = C.CString(info)
+	C.obs_properties_add_text(properties, timecode_info_str, tmp, C.OBS_TEXT_INFO)
+	C.free(unsafe.Pointer(tmp))
+
+	info = "Calibration: no signal"
+	if data != 0 {
+		info = cgo.Handle(data).Value().(*teleportSource).CalibrationDetectorInfo()
+	}
+
+	tmp = C.CString(info)
+	C.obs_properties_add_text(properties, calibration_info_str, tmp, C.OBS_TEXT_INFO)
+	C.free(unsafe.Pointer(tmp))
+
+	prop = C.obs_properties_add_bool(properties, calibrate_str, calibrate_readable_str)
+	C.obs_property_set_long_description(prop, calibrate_description_str)
+
+	prop = C.obs_properties_add_bool(properties, auto_offset_str, auto_offset_readable_str)
+	C.obs_property_set_long_description(prop, auto_offset_description_str)
+
+	prop = C.obs_properties_add_list(properties, catch_up_str, catch_up_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_set_long_description(prop, catch_up_description_str)
+	C.obs_property_list_add_int(prop, catch_up_off_str, 0)
+
+	for _, threshold := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 5 * time.Second} {
+		tmp := C.CString(threshold.String())
+		C.obs_property_list_add_int(prop, tmp, C.longlong(threshold.Milliseconds()))
+		C.free(unsafe.Pointer(tmp))
+	}
+
+	prop = C.obs_properties_add_int(properties, av_offset_str, av_offset_readable_str, -2000, 2000, 1)
+	C.obs_property_int_set_suffix(prop, ms_str)
+	C.obs_property_set_long_description(prop, av_offset_description_str)
+
+	prop = C.obs_properties_add_int(properties, delay_str, delay_readable_str, 0, 10000, 1)
+	C.obs_property_int_set_suffix(prop, ms_str)
+	C.obs_property_set_long_description(prop, delay_description_str)
+
+	prop = C.obs_properties_add_int(properties, lockstep_str, lockstep_readable_str, 0, 5000, 1)
+	C.obs_property_int_set_suffix(prop, ms_str)
+	C.obs_property_set_long_description(prop, lockstep_description_str)
+
+	prop = C.obs_properties_add_list(properties, jitter_buffer_str, jitter_buffer_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_set_long_description(prop, jitter_buffer_description_str)
+	C.obs_property_list_add_int(prop, jitter_buffer_off_str, 0)
+
+	for _, target := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 500 * time.Millisecond} {
+		tmp := C.CString(target.String())
+		C.obs_property_list_add_int(prop, tmp, C.longlong(target.Milliseconds()))
+		C.free(unsafe.Pointer(tmp))
+	}
+
+	prop = C.obs_properties_add_list(properties, sample_rate_str, sample_rate_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_list_add_int(prop, sample_rate_off_str, resampleOff)
+	C.obs_property_list_add_int(prop, sample_rate_obs_str, resampleOBS)
+
+	for _, rate := range []int{44100, 48000} {
+		tmp := C.CString(strconv.Itoa(rate) + " Hz")
+		C.obs_property_list_add_int(prop, tmp, C.longlong(rate))
+		C.free(unsafe.Pointer(tmp))
+	}
+
+	prop = C.obs_properties_add_list(properties, channel_map_str, channel_map_readable_str, C.OBS_COMBO_TYPE_LIST, C.OBS_COMBO_FORMAT_INT)
+	C.obs_property_set_long_description(prop, channel_map_description_str)
+	C.obs_property_list_add_int(prop, channel_map_none_str, channelMapNone)
+	C.obs_property_list_add_int(prop, channel_map_stereo_str, channelMapStereo)
+	C.obs_property_list_add_int(prop, channel_map_mono_str, channelMapMono)
+	C.obs_property_list_add_int(prop, channel_map_swap_str, channelMapSwap)
+	C.obs_property_list_add_int(prop, channel_map_left_str, channelMapLeft)
+	C.obs_property_list_add_int(prop, channel_map_right_str, channelMapRight)
+	C.obs_property_list_add_int(prop, channel_map_custom_str, channelMapCustom)
+	C.obs_property_set_modified_callback(prop, C.obs_property_modified_t(unsafe.Pointer(C.channel_map_callback)))
+
+	prop = C.obs_properties_add_int(properties, channel_left_str, channel_left_readable_str, 1, C.MAX_AUDIO_CHANNELS, 1)
+	C.obs_property_set_long_description(prop, channel_custom_description_str)
+
+	prop = C.obs_properties_add_int(properties, channel_right_str, channel_right_readable_str, 1, C.MAX_AUDIO_CHANNELS, 1)
+	C.obs_property_set_long_description(prop, channel_custom_description_str)
+
+	prop = C.obs_properties_add_bool(properties, drift_str, drift_readable_str)
+	C.obs_property_set_long_description(prop, drift_description_str)
+
+	prop = C.obs_properties_add_bool(properties, bit_exact_str, bit_exact_readable_str)
+	C.obs_property_set_long_description(prop, bit_exact_description_str)
+
+	prop = C.obs_properties_add_bool(properties, reduce_audio_str, reduce_audio_readable_str)
+	C.obs_property_set_long_description(prop, reduce_audio_description_str)
+
 	return properties
 }
 
+//export channel_map_callback
+func channel_map_callback(properties *C.obs_properties_t, prop *C.obs_property_t, settings *C.obs_data_t) C.bool {
+	custom := C.obs_data_get_int(settings, channel_map_str) == channelMapCustom
+
+	C.obs_property_set_visible(C.obs_properties_get(properties, channel_left_str), C.bool(custom))
+	C.obs_property_set_visible(C.obs_properties_get(properties, channel_right_str), C.bool(custom))
+
+	return true
+}
+
 //export source_get_defaults
 func source_get_defaults(settings *C.obs_data_t) {
 	C.obs_data_set_default_string(settings, teleport_list_str, empty_str)
+	C.obs_data_set_default_int(settings, request_quality_str, 0)
+	C.obs_data_set_default_int(settings, request_height_str, 0)
+	C.obs_data_set_default_int(settings, request_max_fps_str, 0)
+
+	track_defaults(settings)
+
+	C.obs_data_set_default_int(settings, sample_rate_str, resampleOff)
+	C.obs_data_set_default_int(settings, channel_map_str, channelMapNone)
+	C.obs_data_set_default_int(settings, channel_left_str, 1)
+	C.obs_data_set_default_int(settings, channel_right_str, 2)
+	C.obs_data_set_default_bool(settings, drift_str, false)
+	C.obs_data_set_default_bool(settings, bit_exact_str, false)
+	C.obs_data_set_default_bool(settings, reduce_audio_str, false)
+	C.obs_data_set_default_int(settings, jitter_buffer_str, 0)
+	C.obs_data_set_default_int(settings, delay_str, 0)
+	C.obs_data_set_default_int(settings, lockstep_str, 0)
+	C.obs_data_set_default_int(settings, av_offset_str, 0)
+	C.obs_data_set_default_int(settings, catch_up_str, 0)
+	C.obs_data_set_default_bool(settings, calibrate_str, false)
+	C.obs_data_set_default_bool(settings, auto_offset_str, false)
 }
 
 //export source_update
@@ -200,12 +469,24 @@ func (t *teleportSource) newPacket(p *Packet) {
 		blog(C.LOG_WARNING, "decode queue exceeded: "+queueSize.String())
 	}
 
+	if t.catchUp > 0 && queueSize > t.catchUp {
+		t.catchUpToLive()
+	}
+
 	t.queueLock.Unlock()
 
 	t.Add(1)
 	go func(p *Packet) {
 		defer t.Done()
 
+		t.queueLock.Lock()
+		dropped := p.Dropped
+		t.queueLock.Unlock()
+
+		if dropped {
+			return
+		}
+
 		defer func() {
 			if r, ok := recover().(error); ok {
 				blog(C.LOG_ERROR, "jpeg corrupt, discarding.. "+r.Error())
@@ -226,6 +507,8 @@ func (t *teleportSource) newPacket(p *Packet) {
 			p.FromJPEG(t.pool)
 		}
 
+		p.Decoded = uint64(C.os_gettime_ns())
+
 		t.queueLock.Lock()
 		defer t.queueLock.Unlock()
 
@@ -259,94 +542,357 @@ func (t *teleportSource) newPacket(p *Packet) {
 				continue
 			}
 
-			if p.IsAudio {
-				t.audio.timestamp = C.uint64_t(p.Header.Timestamp - t.offset)
-				t.audio.samples_per_sec = C.uint(p.WaveHeader.SampleRate)
-				t.audio.speakers = uint32(p.WaveHeader.Speakers)
-				t.audio.format = uint32(p.WaveHeader.Format)
-				t.audio.frames = C.uint(p.WaveHeader.Frames)
-				t.audio.data[0] = (*C.uint8_t)(unsafe.Pointer(&p.Buffer[0]))
+			if t.LockstepEnabled() {
+				t.LockstepPush(p)
+			} else if t.JitterBufferEnabled() {
+				t.JitterBufferPush(p, uint64(C.os_gettime_ns()))
+			} else {
+				t.present(p)
+			}
 
-				C.obs_source_output_audio(t.source, t.audio)
+			t.queue[0] = nil
+			t.queue = t.queue[1:]
+		}
+	}(p)
+}
 
-				t.audio.data[0] = nil
-			} else {
-				switch p.Image.(type) {
-				case *image.YCbCr:
-					img := p.Image.(*image.YCbCr)
-
-					t.frame.linesize[0] = C.uint(img.YStride)
-					t.frame.linesize[1] = C.uint(img.CStride)
-					t.frame.linesize[2] = C.uint(img.CStride)
-					t.frame.data[0] = (*C.uint8_t)(unsafe.Pointer(&img.Y[0]))
-					t.frame.data[1] = (*C.uint8_t)(unsafe.Pointer(&img.Cb[0]))
-					t.frame.data[2] = (*C.uint8_t)(unsafe.Pointer(&img.Cr[0]))
-
-					switch img.SubsampleRatio {
-					case image.YCbCrSubsampleRatio444:
-						t.frame.format = C.VIDEO_FORMAT_I444
-					case image.YCbCrSubsampleRatio422:
-						t.frame.format = C.VIDEO_FORMAT_I422
-					default:
-						t.frame.format = C.VIDEO_FORMAT_I420
-					}
+// delayLoop passes the packets of the delay buffer on once they are due.
+func (t *teleportSource) delayLoop(stop chan any, delay time.Duration, process func(p *Packet)) {
+	defer t.Done()
 
-					if p.ImageHeader.ColorRangeMin == [3]float32{0, 0, 0} && p.ImageHeader.ColorRangeMax == [3]float32{1, 1, 1} {
-						t.frame._range = C.VIDEO_RANGE_FULL
-					} else {
-						t.frame._range = C.VIDEO_RANGE_PARTIAL
-					}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
-					t.frame.width = C.uint(p.Image.Bounds().Dx())
-					t.frame.height = C.uint(p.Image.Bounds().Dy())
-					t.frame.timestamp = C.uint64_t(p.Header.Timestamp - t.offset)
+	signal := t.DelayBufferSignal()
 
-					copy(unsafe.Slice((*float32)(&t.frame.color_matrix[0]), 16), p.ImageHeader.ColorMatrix[:])
-					copy(unsafe.Slice((*float32)(&t.frame.color_range_min[0]), 3), p.ImageHeader.ColorRangeMin[:])
-					copy(unsafe.Slice((*float32)(&t.frame.color_range_max[0]), 3), p.ImageHeader.ColorRangeMax[:])
+	for {
+		select {
+		case <-stop:
+			return
+		case <-signal:
+		case <-timer.C:
+		}
 
-					C.obs_source_output_video2(t.source, t.frame)
+		for {
+			p, wait := t.DelayBufferPop(uint64(C.os_gettime_ns()), delay)
+			if p == nil {
+				timer.Reset(wait)
+				break
+			}
 
-					t.pool.Put(bytes.NewBuffer(img.Y))
+			process(p)
+		}
+	}
+}
 
-					t.frame.data[0] = nil
-					t.frame.data[1] = nil
-					t.frame.data[2] = nil
-				case *image.RGBA:
-					img := p.Image.(*image.RGBA)
+// presentLoop presents the packets of a buffer once pop says they are due.
+func (t *teleportSource) presentLoop(stop chan any, signal chan any, pop func(now uint64) (*Packet, time.Duration)) {
+	defer t.Done()
 
-					t.frame.linesize[0] = C.uint(img.Stride)
-					t.frame.data[0] = (*C.uint8_t)(unsafe.Pointer(&img.Pix[0]))
-					t.frame.format = C.VIDEO_FORMAT_BGR3
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
-					if p.ImageHeader.ColorRangeMin == [3]float32{0, 0, 0} && p.ImageHeader.ColorRangeMax == [3]float32{1, 1, 1} {
-						t.frame._range = C.VIDEO_RANGE_FULL
-					} else {
-						t.frame._range = C.VIDEO_RANGE_PARTIAL
-					}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-signal:
+		case <-timer.C:
+		}
 
-					t.frame.width = C.uint(p.Image.Bounds().Dx())
-					t.frame.height = C.uint(p.Image.Bounds().Dy())
-					t.frame.timestamp = C.uint64_t(p.Header.Timestamp - t.offset)
+		for {
+			p, wait := pop(uint64(C.os_gettime_ns()))
+			if p == nil {
+				timer.Reset(wait)
+				break
+			}
 
-					copy(unsafe.Slice((*float32)(&t.frame.color_matrix[0]), 16), p.ImageHeader.ColorMatrix[:])
-					copy(unsafe.Slice((*float32)(&t.frame.color_range_min[0]), 3), p.ImageHeader.ColorRangeMin[:])
-					copy(unsafe.Slice((*float32)(&t.frame.color_range_max[0]), 3), p.ImageHeader.ColorRangeMax[:])
+			t.queueLock.Lock()
+			t.present(p)
+			t.queueLock.Unlock()
+		}
+	}
+}
 
-					C.obs_source_output_video2(t.source, t.frame)
+// catchUpToLive drops the backlog of the decode queue. All video but the
+// most recent frame goes first. Audio is only dropped if it alone lags
+// twice the threshold behind, so it stays continuous where possible.
+// Must be called with queueLock held.
+func (t *teleportSource) catchUpToLive() {
+	newest := t.queue[len(t.queue)-1].Header.Timestamp
+
+	var latestVideo *Packet
+	for i := len(t.queue) - 1; i >= 0; i-- {
+		if !t.queue[i].IsAudio {
+			latestVideo = t.queue[i]
+			break
+		}
+	}
 
-					t.pool.Put(bytes.NewBuffer(img.Pix))
+	dropAudio := time.Duration(newest-t.queue[0].Header.Timestamp) > 2*t.catchUp
 
-					t.frame.data[0] = nil
-				default:
-					panic(errors.New("invalid video format"))
-				}
+	frames := 0
+
+	t.queue = slices.DeleteFunc(t.queue, func(p *Packet) bool {
+		if p.IsAudio {
+			if dropAudio && time.Duration(newest-p.Header.Timestamp) > t.catchUp {
+				p.Dropped = true
 			}
+		} else if p != latestVideo {
+			p.Dropped = true
+			frames++
+		}
 
-			t.queue[0] = nil
-			t.queue = t.queue[1:]
+		return p.Dropped
+	})
+
+	t.dropped += uint64(frames)
+
+	if frames > 0 && time.Since(t.lastDropped) > time.Minute {
+		t.lastDropped = time.Now()
+		blog(C.LOG_WARNING, fmt.Sprintf("receiver fell behind, dropping frames to catch up (%d total)", t.dropped))
+	}
+}
+
+// DroppedFrames returns the number of frames dropped to catch up to live.
+func (t *teleportSource) DroppedFrames() uint64 {
+	t.queueLock.Lock()
+	defer t.queueLock.Unlock()
+
+	return t.dropped
+}
+
+// TimecodeInfo returns the timecode of the most recent frame.
+func (t *teleportSource) TimecodeInfo() string {
+	t.queueLock.Lock()
+	defer t.queueLock.Unlock()
+
+	if t.timecode.Rate == 0 {
+		return "Timecode: none"
+	}
+
+	return "Timecode: " + t.timecode.String()
+}
+
+// present hands the packet p over to OBS. Must be called with queueLock held.
+func (t *teleportSource) present(p *Packet) {
+	t.LatencyStatsAdd(p, &t.ClockSync)
+
+	if t.calibrate {
+		t.calibration(p)
+	}
+
+	if !p.IsAudio && p.ImageHeader.Timecode.Rate != 0 {
+		if t.timecode.Rate == 0 {
+			blog(C.LOG_INFO, "timecode: "+p.ImageHeader.Timecode.String())
 		}
-	}(p)
+		t.timecode = p.ImageHeader.Timecode
+
+		t.signalTimecode(p.ImageHeader.Timecode, p.Header.Timestamp-t.offset+uint64(max(-t.avOffset, 0)))
+	}
+
+	if p.IsAudio {
+		t.audio.timestamp = C.uint64_t(p.Header.Timestamp - t.offset + uint64(max(t.avOffset, 0)))
+		t.audio.samples_per_sec = C.uint(p.WaveHeader.SampleRate)
+		t.audio.speakers = uint32(p.WaveHeader.Speakers)
+		t.audio.format = uint32(p.WaveHeader.Format)
+		t.audio.frames = C.uint(p.WaveHeader.Frames)
+		t.audio.data[0] = (*C.uint8_t)(unsafe.Pointer(&p.Buffer[0]))
+
+		C.obs_source_output_audio(t.source, t.audio)
+
+		t.audio.data[0] = nil
+	} else {
+		switch p.Image.(type) {
+		case *image.YCbCr:
+			img := p.Image.(*image.YCbCr)
+
+			t.frame.linesize[0] = C.uint(img.YStride)
+			t.frame.linesize[1] = C.uint(img.CStride)
+			t.frame.linesize[2] = C.uint(img.CStride)
+			t.frame.data[0] = (*C.uint8_t)(unsafe.Pointer(&img.Y[0]))
+			t.frame.data[1] = (*C.uint8_t)(unsafe.Pointer(&img.Cb[0]))
+			t.frame.data[2] = (*C.uint8_t)(unsafe.Pointer(&img.Cr[0]))
+
+			switch img.SubsampleRatio {
+			case image.YCbCrSubsampleRatio444:
+				t.frame.format = C.VIDEO_FORMAT_I444
+			case image.YCbCrSubsampleRatio422:
+				t.frame.format = C.VIDEO_FORMAT_I422
+			default:
+				t.frame.format = C.VIDEO_FORMAT_I420
+			}
+
+			if p.ImageHeader.ColorRangeMin == [3]float32{0, 0, 0} && p.ImageHeader.ColorRangeMax == [3]float32{1, 1, 1} {
+				t.frame._range = C.VIDEO_RANGE_FULL
+			} else {
+				t.frame._range = C.VIDEO_RANGE_PARTIAL
+			}
+
+			t.frame.width = C.uint(p.Image.Bounds().Dx())
+			t.frame.height = C.uint(p.Image.Bounds().Dy())
+			t.frame.timestamp = C.uint64_t(p.Header.Timestamp - t.offset + uint64(max(-t.avOffset, 0)))
+
+			copy(unsafe.Slice((*float32)(&t.frame.color_matrix[0]), 16), p.ImageHeader.ColorMatrix[:])
+			copy(unsafe.Slice((*float32)(&t.frame.color_range_min[0]), 3), p.ImageHeader.ColorRangeMin[:])
+			copy(unsafe.Slice((*float32)(&t.frame.color_range_max[0]), 3), p.ImageHeader.ColorRangeMax[:])
+
+			C.obs_source_output_video2(t.source, t.frame)
+
+			t.pool.Put(bytes.NewBuffer(img.Y))
+
+			t.frame.data[0] = nil
+			t.frame.data[1] = nil
+			t.frame.data[2] = nil
+		case *image.RGBA:
+			img := p.Image.(*image.RGBA)
+
+			t.frame.linesize[0] = C.uint(img.Stride)
+			t.frame.data[0] = (*C.uint8_t)(unsafe.Pointer(&img.Pix[0]))
+			t.frame.format = C.VIDEO_FORMAT_BGR3
+
+			if p.ImageHeader.ColorRangeMin == [3]float32{0, 0, 0} && p.ImageHeader.ColorRangeMax == [3]float32{1, 1, 1} {
+				t.frame._range = C.VIDEO_RANGE_FULL
+			} else {
+				t.frame._range = C.VIDEO_RANGE_PARTIAL
+			}
+
+			t.frame.width = C.uint(p.Image.Bounds().Dx())
+			t.frame.height = C.uint(p.Image.Bounds().Dy())
+			t.frame.timestamp = C.uint64_t(p.Header.Timestamp - t.offset + uint64(max(-t.avOffset, 0)))
+
+			copy(unsafe.Slice((*float32)(&t.frame.color_matrix[0]), 16), p.ImageHeader.ColorMatrix[:])
+			copy(unsafe.Slice((*float32)(&t.frame.color_range_min[0]), 3), p.ImageHeader.ColorRangeMin[:])
+			copy(unsafe.Slice((*float32)(&t.frame.color_range_max[0]), 3), p.ImageHeader.ColorRangeMax[:])
+
+			C.obs_source_output_video2(t.source, t.frame)
+
+			t.pool.Put(bytes.NewBuffer(img.Pix))
+
+			t.frame.data[0] = nil
+		default:
+			panic(errors.New("invalid video format"))
+		}
+	}
+}
+
+// calibration measures the A/V offset with the calibration signal in
+// packet p and corrects it if wanted. Must be called with queueLock held.
+func (t *teleportSource) calibration(p *Packet) {
+	out := p.Header.Timestamp - t.offset + uint64(max(t.avOffset, 0))
+	if !p.IsAudio {
+		out = p.Header.Timestamp - t.offset + uint64(max(-t.avOffset, 0))
+	}
+
+	offset, ok := t.CalibrationDetectorAdd(p, out, &t.ClockSync)
+	if !ok || !t.calibrateApply || offset.Abs() < time.Millisecond {
+		return
+	}
+
+	avOffset := min(max(t.avOffset-offset, -2*time.Second), 2*time.Second).Round(time.Millisecond)
+
+	blog(C.LOG_INFO, fmt.Sprintf("calibration: measured A/V offset %v, audio/video offset now %v", offset, avOffset))
+
+	t.avOffset = avOffset
+
+	settings := C.obs_source_get_settings(t.source)
+	C.obs_data_set_int(settings, av_offset_str, C.longlong(avOffset.Milliseconds()))
+	C.obs_data_release(settings)
+}
+
+// signalLevels emits the levels of a track as JSON, so scripts and docks
+// can meter the feed regardless of the source's volume or monitoring.
+func (h *teleportSource) signalLevels(t TrackLevels) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return
+	}
+
+	levels := C.CString(string(b))
+
+	cd := (*C.calldata_t)(C.bzalloc(C.sizeof_calldata_t))
+
+	C.calldata_init(cd)
+	C.calldata_set_ptr(cd, source_param_str, unsafe.Pointer(h.source))
+	C.calldata_set_int(cd, track_param_str, C.longlong(t.Track))
+	C.calldata_set_string(cd, levels_param_str, levels)
+
+	C.signal_handler_signal(C.obs_source_get_signal_handler(h.source), levels_signal_str, cd)
+
+	C.calldata_free(cd)
+	C.bfree(unsafe.Pointer(cd))
+	C.free(unsafe.Pointer(levels))
+}
+
+// signalTimecode emits the timecode of a frame along with the timestamp it
+// is output with, so scripts can burn it in or log it.
+func (h *teleportSource) signalTimecode(t Timecode, timestamp uint64) {
+	timecode := C.CString(t.String())
+
+	cd := (*C.calldata_t)(C.bzalloc(C.sizeof_calldata_t))
+
+	C.calldata_init(cd)
+	C.calldata_set_ptr(cd, source_param_str, unsafe.Pointer(h.source))
+	C.calldata_set_string(cd, timecode_param_str, timecode)
+	C.calldata_set_int(cd, timestamp_param_str, C.longlong(timestamp))
+
+	C.signal_handler_signal(C.obs_source_get_signal_handler(h.source), timecode_signal_str, cd)
+
+	C.calldata_free(cd)
+	C.bfree(unsafe.Pointer(cd))
+	C.free(unsafe.Pointer(timecode))
+}
+
+// readPacket reads a single packet off the stream r.
+func readPacket(r io.Reader) (*Packet, error) {
+	p := &Packet{}
+
+	err := binary.Read(r, binary.LittleEndian, &p.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Header.Type {
+	case [4]byte{'J', 'P', 'E', 'G'}:
+		err = binary.Read(r, binary.LittleEndian, &p.ImageHeader)
+	case [4]byte{'W', 'A', 'V', 'E'}, [4]byte{'O', 'P', 'U', 'S'}, [4]byte{'R', 'I', 'C', 'E'}, [4]byte{'S', 'L', 'N', 'C'}:
+		err = binary.Read(r, binary.LittleEndian, &p.WaveHeader)
+		p.IsAudio = true
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Header.Size < 0 {
+		return nil, errors.New("invalid packet size")
+	}
+
+	p.Buffer = make([]byte, p.Header.Size)
+
+	_, err = io.ReadFull(r, p.Buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func sendControl(c net.Conn, j ControlPayload) error {
+	b, _ := json.Marshal(j)
+
+	header := Header{
+		Type: [4]byte{'C', 'T', 'R', 'L'},
+		Size: int32(len(b)),
+	}
+
+	buf := bytes.Buffer{}
+
+	binary.Write(&buf, binary.LittleEndian, &header)
+	buf.Write(b)
+
+	_, err := c.Write(buf.Bytes())
+
+	return err
 }
 
 func (h *teleportSource) sourceLoop() {
@@ -384,7 +930,13 @@ func (h *teleportSource) sourceLoop() {
 	run = func() {
 		defer h.Done()
 
+		var stop chan any
+
 		defer func() {
+			if stop != nil {
+				close(stop)
+			}
+
 			if r, ok := recover().(error); ok {
 				blog(C.LOG_ERROR, "stream corrupt, re-trying.. "+r.Error())
 
@@ -399,14 +951,69 @@ func (h *teleportSource) sourceLoop() {
 
 		teleport := C.GoString(C.obs_data_get_string(settings, teleport_list_str))
 
+		request := ControlPayload{
+			Protocol: protocolVersion,
+			Quality:  int(C.obs_data_get_int(settings, request_quality_str)),
+			Height:   int(C.obs_data_get_int(settings, request_height_str)),
+			MaxFPS:   int(C.obs_data_get_int(settings, request_max_fps_str)),
+			Codecs:   []string{"lossless", "chunked"},
+		}
+
+		tracks := track_settings(settings)
+		rate := int(C.obs_data_get_int(settings, sample_rate_str))
+		channelMap := int(C.obs_data_get_int(settings, channel_map_str))
+		channelLeft := int(C.obs_data_get_int(settings, channel_left_str))
+		channelRight := int(C.obs_data_get_int(settings, channel_right_str))
+		driftCompensation := bool(C.obs_data_get_bool(settings, drift_str))
+		bitExact := bool(C.obs_data_get_bool(settings, bit_exact_str))
+		reduceAudio := bool(C.obs_data_get_bool(settings, reduce_audio_str))
+		target := time.Duration(C.obs_data_get_int(settings, jitter_buffer_str)) * time.Millisecond
+		delay := time.Duration(C.obs_data_get_int(settings, delay_str)) * time.Millisecond
+		lockstep := time.Duration(C.obs_data_get_int(settings, lockstep_str)) * time.Millisecond
+		avOffset := time.Duration(C.obs_data_get_int(settings, av_offset_str)) * time.Millisecond
+		catchUp := time.Duration(C.obs_data_get_int(settings, catch_up_str)) * time.Millisecond
+		calibrate := bool(C.obs_data_get_bool(settings, calibrate_str))
+		calibrateApply := bool(C.obs_data_get_bool(settings, auto_offset_str))
+
+		if rate == resampleOBS {
+			var oai C.struct_obs_audio_info
+
+			rate = resampleOff
+			if C.obs_get_audio_info(&oai) {
+				rate = int(oai.samples_per_sec)
+			}
+		}
+
+		// conversion stays here, the sender only reduces what it sends on request
+		if reduceAudio && !bitExact {
+			request.SampleRate = rate
+
+			switch channelMap {
+			case channelMapStereo:
+				request.Speakers = C.SPEAKERS_STEREO
+			case channelMapMono:
+				request.Speakers = C.SPEAKERS_MONO
+			}
+		}
+
+		// the fixed latency covers jitter as well
+		if lockstep > 0 {
+			target = 0
+			lockstep += delay
+		}
+
 		C.obs_data_release(settings)
 
+		teleport, request.Variant, _ = strings.Cut(teleport, "#")
+
 		if teleport == "" {
 			C.obs_source_output_video2(h.source, nil)
 
 			return
 		}
 
+		mismatch := false
+
 		for {
 			select {
 			case <-dial:
@@ -425,6 +1032,17 @@ func (h *teleportSource) sourceLoop() {
 				continue
 			}
 
+			// the packets differ between protocol versions, wait for a compatible sender
+			if service.Payload.Protocol != protocolVersion {
+				if !mismatch {
+					blog(C.LOG_WARNING, "protocol mismatch: "+strconv.Itoa(service.Payload.Protocol)+" != "+strconv.Itoa(protocolVersion)+", version: "+service.Payload.Version)
+					mismatch = true
+				}
+				time.Sleep(time.Second)
+				continue
+			}
+			mismatch = false
+
 			var err error
 
 			connMutex.Lock()
@@ -453,6 +1071,59 @@ func (h *teleportSource) sourceLoop() {
 				blog(C.LOG_WARNING, "version mismatch: "+service.Payload.Version+" != "+version)
 			}
 
+			err = sendControl(c, request)
+			if err != nil {
+				blog(C.LOG_WARNING, "unable to send stream request: "+err.Error())
+			}
+
+			h.ClockSyncReset()
+			h.LatencyStatsReset()
+			h.CalibrationDetectorReset()
+
+			stop = make(chan any)
+
+			h.queueLock.Lock()
+			h.JitterBufferReset(target)
+			h.LockstepReset(lockstep)
+			h.avOffset = avOffset
+			h.catchUp = catchUp
+			h.calibrate = calibrate
+			h.timecode = Timecode{}
+			h.calibrateApply = calibrateApply
+			h.queueLock.Unlock()
+
+			h.DelayBufferReset()
+
+			if target > 0 {
+				h.Add(1)
+				go h.presentLoop(stop, h.JitterBufferSignal(), h.JitterBufferPop)
+			}
+
+			if lockstep > 0 {
+				h.Add(1)
+				go h.presentLoop(stop, h.LockstepSignal(), func(now uint64) (*Packet, time.Duration) {
+					return h.LockstepPop(now, &h.ClockSync)
+				})
+			}
+
+			h.Add(1)
+			go func(c net.Conn) {
+				defer h.Done()
+
+				// a quick burst first for a usable estimate right away
+				for i := 0; ; i++ {
+					if sendSync(c) != nil {
+						return
+					}
+
+					if i < 8 {
+						time.Sleep(100 * time.Millisecond)
+					} else {
+						time.Sleep(time.Second)
+					}
+				}
+			}(c)
+
 			h.audio.timestamp = math.MaxUint64
 			h.audio.samples_per_sec = 48000
 			h.audio.speakers = 2
@@ -461,43 +1132,208 @@ func (h *teleportSource) sourceLoop() {
 
 			C.obs_source_output_audio(h.source, h.audio)
 
+			h.AudioLevelsReset()
+
 			h.isStart = true
 			h.queue = nil
 			h.isAudioAndVideo = service.Payload.AudioAndVideo
 
-			for {
-				p := &Packet{}
+			opus := map[int32]*OpusDecoder{}
 
-				err = binary.Read(c, binary.LittleEndian, &p.Header)
-				if err != nil {
-					break
+			var (
+				mixer     TrackMixer
+				resampler Resampler
+				drift     DriftEstimator
+				chunks    ChunkAssembler
+				lastDrift time.Time
+				lastSync  time.Time
+			)
+
+			available := service.Payload.Tracks
+			if len(available) == 0 {
+				available = []int{0}
+			}
+
+			mixTracks := 0
+			for _, track := range available {
+				if slices.Contains(tracks, track) {
+					mixTracks++
 				}
+			}
+
+			process := func(p *Packet) {
+				var err error
+
+				exact := bitExact && (p.Header.Type == [4]byte{'R', 'I', 'C', 'E'} || p.Header.Type == [4]byte{'W', 'A', 'V', 'E'})
+
 				switch p.Header.Type {
-				case [4]byte{'J', 'P', 'E', 'G'}:
-					err = binary.Read(c, binary.LittleEndian, &p.ImageHeader)
+				case [4]byte{'O', 'P', 'U', 'S'}:
+					// decoders keep state, so every track needs its own
+					if !slices.Contains(tracks, int(p.WaveHeader.Track)) {
+						return
+					}
+
+					d, ok := opus[p.WaveHeader.Track]
+					if !ok {
+						d = &OpusDecoder{}
+						opus[p.WaveHeader.Track] = d
+					}
+
+					err = p.FromOPUS(d)
 					if err != nil {
-						break
+						blog(C.LOG_ERROR, "opus corrupt, discarding.. "+err.Error())
+						return
 					}
-				case [4]byte{'W', 'A', 'V', 'E'}:
-					err = binary.Read(c, binary.LittleEndian, &p.WaveHeader)
+				case [4]byte{'R', 'I', 'C', 'E'}:
+					err = p.FromRICE()
 					if err != nil {
-						break
+						blog(C.LOG_ERROR, "lossless audio corrupt, discarding.. "+err.Error())
+						return
+					}
+				case [4]byte{'S', 'L', 'N', 'C'}:
+					err = p.FromSilence()
+					if err != nil {
+						blog(C.LOG_ERROR, "silence corrupt, discarding.. "+err.Error())
+						return
 					}
-					p.IsAudio = true
-				case [4]byte{'A', 'N', 'J', 'A'}:
-					fallthrough
-				default:
-					break
 				}
 
-				p.Buffer = make([]byte, p.Header.Size)
+				if p.IsAudio {
+					err = p.CheckWAVE()
+					if err != nil {
+						blog(C.LOG_ERROR, "audio format mismatch, discarding.. "+err.Error())
+						return
+					}
+
+					p.From24Bit()
+
+					if !slices.Contains(tracks, int(p.WaveHeader.Track)) {
+						return
+					}
+
+					h.signalLevels(h.AudioLevelsUpdate(p))
+
+					// bit-exact audio is neither stretched nor retimed
+					ratio := 1.0
+					if driftCompensation && !exact {
+						drift.DriftEstimatorAdd(p.Header.Timestamp, p.Arrival)
+						ratio = drift.DriftRatio()
+
+						if time.Since(lastDrift) > time.Minute {
+							lastDrift = time.Now()
+							blog(C.LOG_INFO, fmt.Sprintf("clock drift: %.1f ppm", drift.DriftPPM()))
+						}
+					}
+
+					for _, m := range mixer.TrackMixerAdd(p, mixTracks) {
+						if !exact {
+							resampler.ResamplerProcess(m, channelMatrix(channelMap, int(m.WaveHeader.Speakers), channelLeft, channelRight), rate, ratio)
+						}
+						if m.WaveHeader.Frames == 0 {
+							continue
+						}
+
+						m.Sent = m.Header.Timestamp
+						if driftCompensation && !exact {
+							m.Header.Timestamp = drift.DriftTimestamp(m.Header.Timestamp)
+						}
+
+						h.newPacket(m)
+					}
+					return
+				}
+
+				p.Sent = p.Header.Timestamp
+				if driftCompensation {
+					p.Header.Timestamp = drift.DriftTimestamp(p.Header.Timestamp)
+				}
 
-				_, err := io.ReadFull(c, p.Buffer)
+				h.newPacket(p)
+			}
+
+			delayDone := make(chan any)
+
+			if delay > 0 {
+				h.Add(1)
+				go func(c net.Conn, stop chan any) {
+					defer close(delayDone)
+
+					// packets are decoded here, so recover like run does and
+					// have it reconnect by closing the connection
+					defer func() {
+						if r, ok := recover().(error); ok {
+							blog(C.LOG_ERROR, "stream corrupt, re-trying.. "+r.Error())
+
+							c.Close()
+						}
+					}()
+
+					h.delayLoop(stop, delay, process)
+				}(c, stop)
+			} else {
+				close(delayDone)
+			}
+
+			for {
+				p, err := readPacket(c)
 				if err != nil {
 					break
 				}
 
-				h.newPacket(p)
+				if p.Header.Type == [4]byte{'C', 'H', 'N', 'K'} {
+					b, err := chunks.ChunkAssemblerAdd(p.Buffer)
+					if err != nil {
+						blog(C.LOG_ERROR, "chunk corrupt, discarding.. "+err.Error())
+						continue
+					}
+					if b == nil {
+						continue
+					}
+
+					p, err = readPacket(bytes.NewReader(b))
+					if err != nil {
+						blog(C.LOG_ERROR, "chunked packet corrupt, discarding.. "+err.Error())
+						continue
+					}
+				}
+
+				arrival := uint64(C.os_gettime_ns())
+				p.Arrival = arrival
+
+				if p.Header.Type == [4]byte{'S', 'Y', 'N', 'C'} {
+					var j SyncPayload
+
+					err = binary.Read(bytes.NewReader(p.Buffer), binary.LittleEndian, &j)
+					if err != nil {
+						continue
+					}
+
+					h.ClockSyncAdd(j, arrival)
+
+					if time.Since(lastSync) > time.Minute {
+						lastSync = time.Now()
+
+						offset, delay, _ := h.ClockSyncOffset()
+						blog(C.LOG_INFO, fmt.Sprintf("clock offset: %v, round trip: %v", time.Duration(offset), delay))
+					}
+					continue
+				}
+
+				if delay > 0 {
+					h.DelayBufferPush(p)
+					continue
+				}
+
+				process(p)
+			}
+
+			close(stop)
+			stop = nil
+
+			<-delayDone
+
+			for _, d := range opus {
+				d.OpusDecoderClose()
 			}
 		}
 	}
@@ -0,0 +1,157 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	timecodeOff = iota
+	timecodeTimeOfDay
+	timecodeFreeRun
+)
+
+// Timecode is an SMPTE timecode as carried with every video frame. A Rate
+// of 0 means the sender didn't attach one.
+type Timecode struct {
+	Hours   uint8
+	Minutes uint8
+	Seconds uint8
+	Frames  uint8
+	Rate    uint8
+	Drop    uint8
+}
+
+// String formats the timecode the SMPTE way, with a semicolon before the
+// frames for drop-frame timecode.
+func (t Timecode) String() string {
+	if t.Rate == 0 {
+		return ""
+	}
+
+	separator := ":"
+	if t.Drop != 0 {
+		separator = ";"
+	}
+
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", t.Hours, t.Minutes, t.Seconds, separator, t.Frames)
+}
+
+// timecodeFromFrames labels frame number n at a nominal rate. Drop-frame
+// skips the first labels of every minute but each tenth, so the labels of
+// 29.97 and 59.94 fps keep pace with the clock.
+func timecodeFromFrames(n uint64, nominal uint64, drop bool) Timecode {
+	if drop {
+		skip := nominal / 15
+		perMinute := nominal*60 - skip
+		perTenMinutes := nominal*600 - 9*skip
+
+		tens := n / perTenMinutes
+		rest := n % perTenMinutes
+
+		n += 9 * skip * tens
+		if rest > skip {
+			n += skip * ((rest - skip) / perMinute)
+		}
+	}
+
+	t := Timecode{
+		Hours:   uint8(n / (nominal * 3600) % 24),
+		Minutes: uint8(n / (nominal * 60) % 60),
+		Seconds: uint8(n / nominal % 60),
+		Frames:  uint8(n % nominal),
+		Rate:    uint8(nominal),
+	}
+	if drop {
+		t.Drop = 1
+	}
+
+	return t
+}
+
+// TimecodeGenerator derives the timecode of video frames from their
+// timestamps. Time of day is anchored to the wall clock once per session,
+// so the timecode advances steadily with the frames afterwards.
+type TimecodeGenerator struct {
+	sync.Mutex
+	start  uint64
+	anchor time.Time
+	valid  bool
+}
+
+// TimecodeGeneratorReset starts a new session, e.g. when the output starts.
+func (g *TimecodeGenerator) TimecodeGeneratorReset() {
+	g.Lock()
+	defer g.Unlock()
+
+	g.valid = false
+}
+
+// TimecodeGeneratorNext returns the timecode of the frame at timestamp for
+// a frame rate of num/den. Drop-frame only applies to 29.97 and 59.94 fps.
+func (g *TimecodeGenerator) TimecodeGeneratorNext(timestamp uint64, mode int, drop bool, num uint32, den uint32) Timecode {
+	if mode == timecodeOff || num == 0 || den == 0 {
+		return Timecode{}
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	// (re)start on the first frame or on timestamp discontinuities
+	if !g.valid || timestamp < g.start {
+		g.start = timestamp
+		g.anchor = time.Now()
+		g.valid = true
+	}
+
+	fps := float64(num) / float64(den)
+	nominal := uint64(math.Round(fps))
+	drop = drop && den == 1001 && (nominal == 30 || nominal == 60)
+
+	if nominal == 0 || nominal > math.MaxUint8 {
+		return Timecode{}
+	}
+
+	elapsed := time.Duration(timestamp - g.start)
+
+	var n uint64
+
+	switch mode {
+	case timecodeTimeOfDay:
+		now := g.anchor.Add(elapsed)
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+		// non-drop labels follow the clock, skipping one every now and then
+		rate := float64(nominal)
+		if drop {
+			rate = fps
+		}
+		n = uint64(now.Sub(midnight).Seconds() * rate)
+	default:
+		n = uint64(math.Round(elapsed.Seconds() * fps))
+	}
+
+	return timecodeFromFrames(n, nominal, drop)
+}
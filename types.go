@@ -28,12 +28,53 @@ package main
 import "C"
 import "unsafe"
 
+// protocolVersion is bumped with every incompatible change of the packets
+// on the wire. Peers only stream to each other when it matches.
+const protocolVersion = 2
+
 type AnnouncePayload struct {
 	Name          string
 	Port          int
 	AudioAndVideo bool
 	Version       string
-	Address       string `json:",omitempty"`
+	Protocol      int       `json:",omitempty"`
+	Address       string    `json:",omitempty"`
+	Variants      []Variant `json:",omitempty"`
+	Tracks        []int     `json:",omitempty"`
+}
+
+type Variant struct {
+	Name    string
+	Height  int
+	Quality int
+	MaxFPS  int `json:",omitempty"`
+}
+
+type ControlPayload struct {
+	Protocol   int      `json:",omitempty"`
+	Variant    string   `json:",omitempty"`
+	Quality    int      `json:",omitempty"`
+	Height     int      `json:",omitempty"`
+	MaxFPS     int      `json:",omitempty"`
+	Codecs     []string `json:",omitempty"`
+	SampleRate int      `json:",omitempty"`
+	Speakers   int      `json:",omitempty"`
+}
+
+// SyncPayload is a clock exchange. The receiver sets Originate, the
+// sender answers with Receive and Transmit, all in os_gettime_ns time.
+type SyncPayload struct {
+	Originate uint64
+	Receive   uint64
+	Transmit  uint64
+}
+
+// ChunkHeader precedes a piece of a large packet that is sent in chunks,
+// so other packets can go out in between. Total is the size of the whole
+// serialized packet, Offset where this piece belongs.
+type ChunkHeader struct {
+	Offset uint32
+	Total  uint32
 }
 
 type Header struct {
@@ -46,6 +87,9 @@ type ImageHeader struct {
 	ColorMatrix   [16]float32
 	ColorRangeMin [3]float32
 	ColorRangeMax [3]float32
+	Timecode      Timecode
+	Capture       uint64
+	Encoded       uint64
 }
 
 type WaveHeader struct {
@@ -53,6 +97,10 @@ type WaveHeader struct {
 	SampleRate int32
 	Speakers   int32
 	Frames     int32
+	Track      int32
+	Peak       [C.MAX_AUDIO_CHANNELS]float32
+	RMS        [C.MAX_AUDIO_CHANNELS]float32
+	Capture    uint64
 }
 
 func blog(log_level C.int, message string) {
@@ -20,6 +20,7 @@
 
 #include <obs-module.h>
 #include <jconfig.h>
+#include <opus/opus.h>
 
 #define STRINGIFY(x) #x
 #define TOSTRING(x) STRINGIFY(x)
@@ -31,3 +32,7 @@ void blog_string(const int log_level, const char* string) {
 const char* jpeg_version() {
     return TOSTRING(LIBJPEG_TURBO_VERSION);
 }
+
+int set_opus_bitrate(OpusEncoder *st, int bitrate) {
+    return opus_encoder_ctl(st, OPUS_SET_BITRATE(bitrate));
+}
@@ -0,0 +1,56 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+// ToVariants creates and encodes a copy of p for every variant. Variants
+// that are not smaller than p share its image, so this must be called
+// before p itself is encoded.
+func (p *Packet) ToVariants(pool *Pool, variants []Variant, algorithm int) {
+	for _, v := range variants {
+		vp := &Packet{
+			Header:      p.Header,
+			ImageHeader: p.ImageHeader,
+			Quality:     v.Quality,
+			Variant:     v.Name,
+			Image:       p.Image,
+		}
+
+		if vp.Quality == 0 {
+			vp.Quality = p.Quality
+		}
+
+		if v.Height != 0 && v.Height < p.Image.Bounds().Dy() {
+			vp.Image, vp.ImageBuffer = scaleImage(pool, p.Image, ScaleSettings{
+				Height:    v.Height,
+				Algorithm: algorithm,
+			})
+		}
+
+		vp.ToJPEG(pool)
+
+		p.Variants = append(p.Variants, vp)
+	}
+}
+
+// Packets returns p followed by all of its variants.
+func (p *Packet) Packets() []*Packet {
+	return append([]*Packet{p}, p.Variants...)
+}
@@ -0,0 +1,185 @@
+//
+// obs-teleport. OBS Studio plugin.
+// Copyright (C) 2021-2026 Florian Zwoch <fzwoch@gmail.com>
+//
+// This file is part of obs-teleport.
+//
+// obs-teleport is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 2 of the License, or
+// (at your option) any later version.
+//
+// obs-teleport is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with obs-teleport. If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+//
+// #include <obs-module.h>
+//
+import "C"
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// AudioWire is the audio format a receiver asks for. Zero fields keep the
+// format of the sender.
+type AudioWire struct {
+	SampleRate int
+	Speakers   int
+}
+
+// AudioSettings are the sender settings for outgoing audio.
+type AudioSettings struct {
+	Codec            int
+	Bitrate          int
+	FrameSize        time.Duration
+	Depth            int
+	SendChannels     int
+	Silence          bool
+	SilenceThreshold float64
+}
+
+type audioWireKey struct {
+	wire  AudioWire
+	track int32
+}
+
+type audioWireState struct {
+	Resampler
+	OpusEncoder
+}
+
+// AudioWires converts and encodes audio for every wire format receivers
+// asked for. Conversion and encoder state is kept per format and track.
+type AudioWires struct {
+	sync.Mutex
+	states map[audioWireKey]*audioWireState
+}
+
+// AudioWiresSend converts the WAVE packet p to the wire format of every
+// receiver of s and sends it encoded as configured by a.
+func (w *AudioWires) AudioWiresSend(s *Sender, p *Packet, a AudioSettings) {
+	w.Lock()
+	defer w.Unlock()
+
+	wires := s.SenderGetAudioWires()
+
+	for key, state := range w.states {
+		if _, ok := wires[key.wire]; !ok {
+			state.OpusEncoderClose()
+			delete(w.states, key)
+		}
+	}
+
+	for wire := range wires {
+		key := audioWireKey{
+			wire:  wire,
+			track: p.WaveHeader.Track,
+		}
+
+		if w.states == nil {
+			w.states = make(map[audioWireKey]*audioWireState)
+		}
+
+		state, ok := w.states[key]
+		if !ok {
+			state = &audioWireState{}
+			w.states[key] = state
+		}
+
+		q := p.ToWire(&state.Resampler, wire)
+
+		q.ToReduced(sendChannelMatrix(a.SendChannels, int(q.WaveHeader.Speakers)), a.Depth)
+		q.ToLevels()
+
+		// after reducing, so silence is described like the audio around it
+		if a.Silence && q.WavePeak() < a.SilenceThreshold {
+			s.SenderSendAudio(wire, q.ToSilence())
+			continue
+		}
+
+		switch a.Codec {
+		case audioCodecLossless:
+			s.SenderSendLossless(wire, q.ToRICE(), q.Buffer)
+			continue
+		case audioCodecOpus:
+			packets, ok := state.OpusEncode(q, a.Bitrate, a.FrameSize)
+			if ok {
+				for _, b := range packets {
+					s.SenderSendAudio(wire, b)
+				}
+				continue
+			}
+		}
+
+		s.SenderSendAudio(wire, q.Buffer)
+	}
+}
+
+func (w *AudioWires) AudioWiresClose() {
+	w.Lock()
+	defer w.Unlock()
+
+	for _, state := range w.states {
+		state.OpusEncoderClose()
+	}
+
+	w.states = nil
+}
+
+// ToWire returns a copy of the WAVE packet p reduced to the sample rate and
+// speaker layout of wire. Audio is only ever downsampled or downmixed, as
+// this is about bandwidth, anything else is up to the receiver. p itself
+// stays untouched, as it is shared by all wire formats.
+func (p *Packet) ToWire(r *Resampler, wire AudioWire) *Packet {
+	var matrix [][]float32
+
+	speakers := int(p.WaveHeader.Speakers)
+	if C.get_audio_channels(C.enum_speaker_layout(wire.Speakers)) < C.get_audio_channels(C.enum_speaker_layout(speakers)) {
+		switch wire.Speakers {
+		case C.SPEAKERS_STEREO:
+			matrix = channelMatrix(channelMapStereo, speakers, 0, 0)
+		case C.SPEAKERS_MONO:
+			matrix = channelMatrix(channelMapMono, speakers, 0, 0)
+		}
+	}
+
+	rate := wire.SampleRate
+	if rate >= int(p.WaveHeader.SampleRate) {
+		rate = 0
+	}
+
+	if matrix == nil && rate == 0 {
+		q := *p
+		q.Buffer = bytes.Clone(p.Buffer)
+
+		return &q
+	}
+
+	q := &Packet{
+		Header:     p.Header,
+		WaveHeader: p.WaveHeader,
+		Buffer:     p.Buffer[len(p.Buffer)-int(p.Header.Size):],
+	}
+
+	r.ResamplerProcess(q, matrix, rate, 1)
+
+	h := bytes.Buffer{}
+
+	binary.Write(&h, binary.LittleEndian, &q.Header)
+	binary.Write(&h, binary.LittleEndian, &q.WaveHeader)
+
+	q.Buffer = append(h.Bytes(), q.Buffer...)
+
+	return q
+}